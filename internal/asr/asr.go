@@ -6,7 +6,6 @@ import (
 	"strings"
 	"sync"
 
-	"github.com/hraban/opus"
 	sherpa "github.com/k2-fsa/sherpa-onnx-go/sherpa_onnx"
 	"github.com/phamviet/xiaozhi-hub/internal/audio"
 )
@@ -15,15 +14,34 @@ const SampleRate = 16000
 const FrameSizeMs = 60
 const FrameSize = int(float32(SampleRate) * float32(FrameSizeMs) / 1000)
 
+// leadingSamples of silence kept before a streaming utterance starts (500ms)
+const leadingSamples = SampleRate / 2
+
+// Utterance is the final transcript of a speech segment with its 16kHz mono audio
+type Utterance struct {
+	Text    string
+	Samples []float32
+}
+
 type Asr struct {
 	mu         *sync.RWMutex
-	result     chan string
+	result     chan Utterance
+	finals     chan Utterance
+	done       chan struct{}
+	partial    chan string
+	speaking   chan struct{}
+	inSpeech   bool
 	speechChan chan *sherpa.GeneratedAudio
 	sampleRate int
-	decoder    *opus.Decoder
+	// decodeMu is held across Decode, SetInputFormat may only free a decoder nothing is using
+	decodeMu   sync.Mutex
+	decoder    inputDecoder
 	vad        *sherpa.VoiceActivityDetector
 	buffer     *sherpa.CircularBuffer
 	stt        SpeechToText
+	stream     RecognitionStream
+	hypothesis string
+	utterance  []float32
 	stopChan   chan struct{}
 	started    bool
 
@@ -38,10 +56,16 @@ func WithLogger(logger *slog.Logger) Option {
 	}
 }
 
+func WithSpeechToText(stt SpeechToText) Option {
+	return func(asr *Asr) {
+		asr.stt = stt
+	}
+}
+
 func NewAsr(opts ...Option) (*Asr, error) {
-	decoder, err := opus.NewDecoder(16000, 1)
+	decoder, err := newInputDecoder(DefaultInputFormat)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create opus decoder: %w", err)
+		return nil, err
 	}
 
 	vad := NewVad()
@@ -54,10 +78,13 @@ func NewAsr(opts ...Option) (*Asr, error) {
 		decoder:    decoder,
 		vad:        vad,
 		buffer:     buffer,
-		stt:        NewOpenAi(""),
 		sampleRate: SampleRate,
 		speechChan: make(chan *sherpa.GeneratedAudio, 100),
-		result:     make(chan string),
+		result:     make(chan Utterance),
+		finals:     make(chan Utterance, 10),
+		done:       make(chan struct{}),
+		partial:    make(chan string, 10),
+		speaking:   make(chan struct{}, 1),
 		stopChan:   make(chan struct{}),
 		logger:     slog.Default(),
 	}
@@ -66,13 +93,62 @@ func NewAsr(opts ...Option) (*Asr, error) {
 		opt(a)
 	}
 
+	if a.stt == nil {
+		a.Close()
+		return nil, fmt.Errorf("speech-to-text provider is not configured")
+	}
+
+	if streaming, ok := a.stt.(StreamingSpeechToText); ok {
+		stream, err := streaming.NewStream()
+		if err != nil {
+			a.Close()
+			return nil, err
+		}
+		a.stream = stream
+		go a.processFinals()
+	}
+
 	return a, nil
 }
 
-func (a *Asr) Result() <-chan string {
+// SetInputFormat switches the decoder to the format the device announced in its hello
+func (a *Asr) SetInputFormat(f InputFormat) error {
+	decoder, err := newInputDecoder(f)
+	if err != nil {
+		return err
+	}
+
+	a.decodeMu.Lock()
+	previous := a.decoder
+	a.decoder = decoder
+	a.decodeMu.Unlock()
+
+	previous.Close()
+	return nil
+}
+
+// Result emits the final text of each utterance
+func (a *Asr) Result() <-chan Utterance {
 	return a.result
 }
 
+// Partial emits interim hypotheses while the user is speaking, only with a streaming provider
+func (a *Asr) Partial() <-chan string {
+	return a.partial
+}
+
+// SpeechStarted signals the beginning of each utterance, used to interrupt playback
+func (a *Asr) SpeechStarted() <-chan struct{} {
+	return a.speaking
+}
+
+func (a *Asr) notifySpeechStart() {
+	select {
+	case a.speaking <- struct{}{}:
+	default:
+	}
+}
+
 func (a *Asr) Write(data []byte) error {
 	if !a.started {
 		return fmt.Errorf("ASR not started")
@@ -92,20 +168,23 @@ func (a *Asr) Write(data []byte) error {
 }
 
 func (a *Asr) decodeAudio(data []byte) {
-	buf := make([]float32, FrameSize)
-	n, err := a.decoder.DecodeFloat32(data, buf)
-
+	a.decodeMu.Lock()
+	samples, err := a.decoder.Decode(data)
+	a.decodeMu.Unlock()
 	if err != nil {
-		a.logger.Error("Failed to decode opus data: %v", err)
+		a.logger.Error("Failed to decode audio data", "error", err)
 		return
 	}
 
-	if n == 0 {
-		a.logger.Warn("Empty audio data in frame, skipping")
+	if len(samples) == 0 {
+		return
+	}
+
+	if a.stream != nil {
+		a.decodeStream(samples)
 		return
 	}
 
-	samples := buf[:n]
 	a.buffer.Push(samples)
 
 	for a.buffer.Size() >= WindowSizeVad {
@@ -115,6 +194,12 @@ func (a *Asr) decodeAudio(data []byte) {
 
 		a.vad.AcceptWaveform(s)
 
+		speaking := a.vad.IsSpeech()
+		if speaking && !a.inSpeech {
+			a.notifySpeechStart()
+		}
+		a.inSpeech = speaking
+
 		for !a.vad.IsEmpty() {
 			speechSegment := a.vad.Front()
 			a.vad.Pop()
@@ -137,29 +222,106 @@ func (a *Asr) decodeAudio(data []byte) {
 
 }
 
+// decodeStream feeds the streaming recognizer and emits its hypotheses, the
+// final text is sent as soon as the recognizer detects an endpoint.
+func (a *Asr) decodeStream(samples []float32) {
+	a.mu.Lock()
+	a.stream.AcceptWaveform(samples, a.sampleRate)
+	text, endpoint := a.stream.Decode()
+	started := a.hypothesis == "" && text != ""
+	changed := text != a.hypothesis
+	a.hypothesis = text
+
+	a.utterance = append(a.utterance, samples...)
+	if text == "" && len(a.utterance) > leadingSamples {
+		// no speech yet, only keep a bit of lead-in
+		a.utterance = append(a.utterance[:0], a.utterance[len(a.utterance)-leadingSamples:]...)
+	}
+	utterance := Utterance{Text: text}
+	if endpoint {
+		utterance.Samples = a.utterance
+		a.utterance = nil
+		a.stream.Reset()
+		a.hypothesis = ""
+	}
+	stopChan := a.stopChan
+	a.mu.Unlock()
+
+	if text == "" {
+		return
+	}
+
+	if started {
+		a.notifySpeechStart()
+	}
+
+	if endpoint {
+		a.logger.Info(fmt.Sprintf("Transcribed speech: %s", text))
+		// Write must not wait for the consumer, it runs on the read loop of the device
+		select {
+		case a.finals <- utterance:
+		case <-stopChan:
+		default:
+			a.logger.Warn("Final channel full, dropping utterance")
+		}
+		return
+	}
+
+	if changed {
+		select {
+		case a.partial <- text:
+		default:
+			// the client is behind, the next hypothesis supersedes this one anyway
+		}
+	}
+}
+
+// processFinals hands the finals of the streaming recognizer to the consumer until Close
+func (a *Asr) processFinals() {
+	for {
+		select {
+		case <-a.done:
+			return
+		case utterance := <-a.finals:
+			select {
+			case a.result <- utterance:
+			case <-a.done:
+				return
+			}
+		}
+	}
+}
+
 func (a *Asr) processSpeechChan() {
 	for speech := range a.speechChan {
 		select {
 		case <-a.stopChan:
 			return
 		default:
-			wavBytes, err := audio.Float32ToWavBytes(speech.Samples, speech.SampleRate)
-			if err != nil {
-				a.logger.Error("Failed to read temp WAV file", "error", err)
-				continue
-			}
-
-			text, err := a.stt.Transcribe(wavBytes)
+			text, err := a.transcribe(speech)
 			if err != nil {
 				a.logger.Error("Failed to transcribe speech", "error", err)
 				continue
 			}
 			a.logger.Info(fmt.Sprintf("Transcribed speech: %s", text))
-			a.result <- strings.TrimSpace(text)
+			a.result <- Utterance{Text: strings.TrimSpace(text), Samples: speech.Samples}
 		}
 	}
 }
 
+func (a *Asr) transcribe(speech *sherpa.GeneratedAudio) (string, error) {
+	if st, ok := a.stt.(SampleTranscriber); ok {
+		return st.TranscribeSamples(speech.Samples, speech.SampleRate)
+	}
+
+	wavBytes, err := audio.Float32ToWavBytes(speech.Samples, speech.SampleRate)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode speech to WAV: %w", err)
+	}
+
+	return a.stt.Transcribe(wavBytes)
+}
+
 func (a *Asr) Start() {
 	a.mu.Lock()
 	defer a.mu.Unlock()
@@ -168,8 +330,16 @@ func (a *Asr) Start() {
 	}
 
 	a.stopChan = make(chan struct{})
-	a.speechChan = make(chan *sherpa.GeneratedAudio, 100)
 	a.started = true
+	if a.stream != nil {
+		// finals of the previous listening session are stale
+		for len(a.finals) > 0 {
+			<-a.finals
+		}
+		return
+	}
+
+	a.speechChan = make(chan *sherpa.GeneratedAudio, 100)
 	go a.processSpeechChan()
 }
 
@@ -183,14 +353,29 @@ func (a *Asr) Stop() {
 
 	a.started = false
 	close(a.stopChan)
-	close(a.speechChan)
-
 	a.logger.Debug("asr.Stop")
+
+	if a.stream != nil {
+		a.stream.Reset()
+		a.hypothesis = ""
+		a.utterance = nil
+		return
+	}
+
+	close(a.speechChan)
 	a.vad.Clear()
+	a.inSpeech = false
 }
 
 func (a *Asr) Close() {
 	a.Stop()
+	close(a.done)
+	if a.stream != nil {
+		a.stream.Close()
+	}
+	a.decodeMu.Lock()
+	a.decoder.Close()
+	a.decodeMu.Unlock()
 	sherpa.DeleteVoiceActivityDetector(a.vad)
 	sherpa.DeleteCircularBuffer(a.buffer)
 }
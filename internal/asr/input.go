@@ -0,0 +1,173 @@
+package asr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/hraban/opus"
+	"github.com/zaf/resample"
+)
+
+// maxOpusFrameMs is the longest frame an Opus packet can carry
+const maxOpusFrameMs = 120
+
+// InputFormat is the device audio announced in the hello `audio_params`
+type InputFormat struct {
+	Format        string // "opus" or "pcm" (16-bit little-endian)
+	SampleRate    int
+	Channels      int
+	FrameDuration int // ms, informational: Opus packets carry their own duration
+}
+
+// DefaultInputFormat is what ESP32 boards send when the hello has no audio_params
+var DefaultInputFormat = InputFormat{Format: "opus", SampleRate: 16000, Channels: 1, FrameDuration: 60}
+
+// inputDecoder turns one device packet into 16kHz mono samples for the VAD and recognizer
+type inputDecoder interface {
+	Decode(packet []byte) ([]float32, error)
+	Close()
+}
+
+func newInputDecoder(f InputFormat) (inputDecoder, error) {
+	// older firmware leaves out what it considers the default
+	if f.SampleRate == 0 {
+		f.SampleRate = DefaultInputFormat.SampleRate
+	}
+	if f.Channels == 0 {
+		f.Channels = DefaultInputFormat.Channels
+	}
+
+	if f.Channels < 1 || f.Channels > 2 {
+		return nil, fmt.Errorf("unsupported channel count: %d", f.Channels)
+	}
+
+	switch f.Format {
+	case "opus":
+		switch f.SampleRate {
+		case 8000, 12000, 16000, 24000, 48000:
+		default:
+			return nil, fmt.Errorf("unsupported opus sample rate: %d", f.SampleRate)
+		}
+		return newOpusInput(f.Channels)
+	case "pcm":
+		if f.SampleRate <= 0 {
+			return nil, fmt.Errorf("invalid pcm sample rate: %d", f.SampleRate)
+		}
+		return newPcmInput(f.SampleRate, f.Channels)
+	default:
+		return nil, fmt.Errorf("unsupported audio format: %q", f.Format)
+	}
+}
+
+type opusInput struct {
+	decoder  *opus.Decoder
+	channels int
+	buf      []float32
+}
+
+// newOpusInput decodes straight to 16kHz, an Opus decoder can output any supported
+// rate whatever the rate the device encoded at
+func newOpusInput(channels int) (*opusInput, error) {
+	decoder, err := opus.NewDecoder(SampleRate, channels)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create opus decoder: %w", err)
+	}
+
+	return &opusInput{
+		decoder:  decoder,
+		channels: channels,
+		buf:      make([]float32, SampleRate*maxOpusFrameMs/1000*channels),
+	}, nil
+}
+
+func (d *opusInput) Decode(packet []byte) ([]float32, error) {
+	n, err := d.decoder.DecodeFloat32(packet, d.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return downmix(d.buf[:n*d.channels], d.channels), nil
+}
+
+func (d *opusInput) Close() {}
+
+type pcmInput struct {
+	sampleRate int
+	channels   int
+	pending    []byte
+	resampler  *resample.Resampler
+	resampled  *bytes.Buffer
+}
+
+func newPcmInput(sampleRate, channels int) (*pcmInput, error) {
+	d := &pcmInput{sampleRate: sampleRate, channels: channels}
+	if sampleRate == SampleRate {
+		return d, nil
+	}
+
+	d.resampled = &bytes.Buffer{}
+	res, err := resample.New(d.resampled, float64(sampleRate), float64(SampleRate), 1, resample.I16, resample.MediumQ)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resampler: %w", err)
+	}
+	d.resampler = res
+
+	return d, nil
+}
+
+func (d *pcmInput) Decode(packet []byte) ([]float32, error) {
+	// a sample frame may straddle two packets
+	data := append(d.pending, packet...)
+	frameSize := 2 * d.channels
+	frames := len(data) / frameSize
+	d.pending = append([]byte(nil), data[frames*frameSize:]...)
+
+	mono := make([]byte, frames*2)
+	for i := 0; i < frames; i++ {
+		sum := 0
+		for ch := 0; ch < d.channels; ch++ {
+			sum += int(int16(binary.LittleEndian.Uint16(data[(i*d.channels+ch)*2:])))
+		}
+		binary.LittleEndian.PutUint16(mono[i*2:], uint16(int16(sum/d.channels)))
+	}
+
+	if d.resampler != nil {
+		if _, err := d.resampler.Write(mono); err != nil {
+			return nil, fmt.Errorf("failed to resample: %w", err)
+		}
+		mono = bytes.Clone(d.resampled.Bytes())
+		d.resampled.Reset()
+	}
+
+	samples := make([]float32, len(mono)/2)
+	for i := range samples {
+		samples[i] = float32(int16(binary.LittleEndian.Uint16(mono[i*2:]))) / 32768
+	}
+
+	return samples, nil
+}
+
+func (d *pcmInput) Close() {
+	if d.resampler != nil {
+		_ = d.resampler.Close()
+	}
+}
+
+// downmix averages interleaved channels in place
+func downmix(samples []float32, channels int) []float32 {
+	if channels == 1 {
+		return samples
+	}
+
+	frames := len(samples) / channels
+	for i := 0; i < frames; i++ {
+		var sum float32
+		for ch := 0; ch < channels; ch++ {
+			sum += samples[i*channels+ch]
+		}
+		samples[i] = sum / float32(channels)
+	}
+
+	return samples[:frames]
+}
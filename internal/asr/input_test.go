@@ -0,0 +1,49 @@
+package asr
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestPcmInputDownmix(t *testing.T) {
+	d, err := newInputDecoder(InputFormat{Format: "pcm", SampleRate: SampleRate, Channels: 2})
+	if err != nil {
+		t.Fatalf("newInputDecoder: %v", err)
+	}
+	defer d.Close()
+
+	var packet []byte
+	for _, s := range []int16{16384, 0, -16384, -16384, 100} {
+		packet = binary.LittleEndian.AppendUint16(packet, uint16(s))
+	}
+
+	// the last sample is half a stereo frame, it waits for the next packet
+	samples, err := d.Decode(packet)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(samples) != 2 || samples[0] != 0.25 || samples[1] != -0.5 {
+		t.Fatalf("Decode() = %v, want [0.25 -0.5]", samples)
+	}
+
+	samples, err = d.Decode(binary.LittleEndian.AppendUint16(nil, uint16(100)))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(samples) != 1 {
+		t.Fatalf("Decode() = %v, want the completed frame", samples)
+	}
+}
+
+func TestInputFormatValidation(t *testing.T) {
+	for _, f := range []InputFormat{
+		{Format: "opus", SampleRate: 44100, Channels: 1},
+		{Format: "pcm", SampleRate: 16000, Channels: 3},
+		{Format: "mp3", SampleRate: 16000, Channels: 1},
+	} {
+		if d, err := newInputDecoder(f); err == nil {
+			d.Close()
+			t.Errorf("newInputDecoder(%+v) succeeded, want an error", f)
+		}
+	}
+}
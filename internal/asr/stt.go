@@ -1,13 +1,55 @@
 package asr
 
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
 type SpeechToText interface {
 	Transcribe(audio []byte) (string, error)
 }
 
-type SttConfig struct {
-	OpenAi struct {
-		ApiKey  string
-		Model   string
-		BaseURL string
+// Config is built from an ASR `model_config` record
+type Config struct {
+	Params   map[string]string // config_json with secrets resolved
+	Language string            // ai_agent.lang_code
+}
+
+// Factory creates a SpeechToText for a provider
+type Factory func(cfg Config) (SpeechToText, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]Factory)
+)
+
+// Register makes a SpeechToText provider available by its `provider_code`
+func Register(providerCode string, factory Factory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[providerCode] = factory
+}
+
+// NewSpeechToText creates the SpeechToText registered for providerCode
+func NewSpeechToText(providerCode string, cfg Config) (SpeechToText, error) {
+	providersMu.RLock()
+	factory, ok := providers[providerCode]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported asr provider: %s", providerCode)
+	}
+
+	if cfg.Params == nil {
+		cfg.Params = make(map[string]string)
 	}
+
+	return factory(cfg)
+}
+
+// ISO639 returns the two-letter language of a code like "vi-VN"
+func (c Config) ISO639() string {
+	lang, _, _ := strings.Cut(c.Language, "-")
+	lang, _, _ = strings.Cut(lang, "_")
+	return strings.ToLower(lang)
 }
@@ -8,26 +8,52 @@ import (
 	"mime/multipart"
 	"net/http"
 	"os"
+	"strings"
 )
 
+func init() {
+	Register("openai", NewOpenAi)
+}
+
+// OpenAi talks to any OpenAI compatible `/audio/transcriptions` endpoint (OpenAI, Groq, local whisper servers...)
 type OpenAi struct {
 	apiKey   string
 	model    string
 	language string
-	baseURL  string
+	endpoint string
 }
 
-func NewOpenAi(apiKey string) SpeechToText {
+func NewOpenAi(cfg Config) (SpeechToText, error) {
+	apiKey := cfg.Params["api_key"]
 	if apiKey == "" {
 		apiKey = os.Getenv("OPENAI_API_KEY")
 	}
 
+	model := cfg.Params["model_name"]
+	if model == "" {
+		model = "whisper-1"
+	}
+
+	// base_url may either be the API root or the full transcriptions endpoint
+	endpoint := strings.TrimSuffix(cfg.Params["base_url"], "/")
+	if endpoint == "" {
+		endpoint = "https://api.openai.com/v1"
+	}
+	if !strings.HasSuffix(endpoint, "/audio/transcriptions") {
+		endpoint += "/audio/transcriptions"
+	}
+
+	language := cfg.Params["language"]
+	if language == "" {
+		language = cfg.ISO639()
+	}
+
 	return &OpenAi{
 		apiKey:   apiKey,
-		model:    "whisper-large-v3-turbo",
-		language: "vi",
-		baseURL:  "https://api.groq.com/openai/v1",
-	}
+		model:    model,
+		language: language,
+		endpoint: endpoint,
+	}, nil
 }
 
 func (o *OpenAi) Transcribe(audio []byte) (string, error) {
@@ -52,12 +78,14 @@ func (o *OpenAi) Transcribe(audio []byte) (string, error) {
 		return "", fmt.Errorf("failed to close multipart writer: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/audio/transcriptions", o.baseURL), body)
+	req, err := http.NewRequest("POST", o.endpoint, body)
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
 	client := &http.Client{}
@@ -0,0 +1,155 @@
+package asr
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	sherpa "github.com/k2-fsa/sherpa-onnx-go/sherpa_onnx"
+)
+
+func init() {
+	Register("sherpa_onnx", NewSherpaOffline)
+}
+
+// SampleTranscriber is implemented by providers that decode PCM samples directly,
+// which lets the ASR skip encoding every speech segment to WAV.
+type SampleTranscriber interface {
+	TranscribeSamples(samples []float32, sampleRate int) (string, error)
+}
+
+// offlineRecognizer is shared by all connections using the same model files,
+// loading a model per device would quickly exhaust memory.
+type offlineRecognizer struct {
+	mu         sync.Mutex
+	recognizer *sherpa.OfflineRecognizer
+}
+
+var (
+	offlineRecognizersMu sync.Mutex
+	offlineRecognizers   = make(map[string]*offlineRecognizer)
+)
+
+// SherpaOffline runs a sherpa-onnx offline recognizer (Whisper, Paraformer, SenseVoice) on CPU
+type SherpaOffline struct {
+	recognizer *offlineRecognizer
+}
+
+// NewSherpaOffline creates a local recognizer from the model_config params:
+//   - model_type: whisper, paraformer or sense_voice
+//   - model_dir: directory the model files are relative to
+//   - encoder, decoder (whisper), model (paraformer, sense_voice), tokens
+//   - num_threads, provider (cpu by default)
+func NewSherpaOffline(cfg Config) (SpeechToText, error) {
+	config, err := newOfflineRecognizerConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("%+v", *config)
+
+	offlineRecognizersMu.Lock()
+	defer offlineRecognizersMu.Unlock()
+
+	if r, ok := offlineRecognizers[key]; ok {
+		return &SherpaOffline{recognizer: r}, nil
+	}
+
+	recognizer := sherpa.NewOfflineRecognizer(config)
+	if recognizer == nil {
+		return nil, fmt.Errorf("failed to create sherpa-onnx offline recognizer, check the model files")
+	}
+
+	r := &offlineRecognizer{recognizer: recognizer}
+	offlineRecognizers[key] = r
+
+	return &SherpaOffline{recognizer: r}, nil
+}
+
+func newOfflineRecognizerConfig(cfg Config) (*sherpa.OfflineRecognizerConfig, error) {
+	path := func(key string) string {
+		name := cfg.Params[key]
+		if name == "" || filepath.IsAbs(name) {
+			return name
+		}
+		return filepath.Join(cfg.Params["model_dir"], name)
+	}
+
+	config := &sherpa.OfflineRecognizerConfig{}
+	config.FeatConfig = sherpa.FeatureConfig{SampleRate: SampleRate, FeatureDim: 80}
+	config.DecodingMethod = "greedy_search"
+	config.ModelConfig.Tokens = path("tokens")
+	config.ModelConfig.NumThreads = 2
+	config.ModelConfig.Provider = "cpu"
+
+	if n, err := strconv.Atoi(cfg.Params["num_threads"]); err == nil && n > 0 {
+		config.ModelConfig.NumThreads = n
+	}
+	if provider := cfg.Params["provider"]; provider != "" {
+		config.ModelConfig.Provider = provider
+	}
+
+	switch modelType := strings.ToLower(cfg.Params["model_type"]); modelType {
+	case "whisper":
+		config.ModelConfig.Whisper.Encoder = path("encoder")
+		config.ModelConfig.Whisper.Decoder = path("decoder")
+		config.ModelConfig.Whisper.Language = cfg.ISO639()
+		config.ModelConfig.Whisper.Task = "transcribe"
+		config.ModelConfig.Whisper.TailPaddings = -1
+		if config.ModelConfig.Whisper.Encoder == "" || config.ModelConfig.Whisper.Decoder == "" {
+			return nil, fmt.Errorf("whisper requires encoder and decoder")
+		}
+	case "paraformer":
+		config.ModelConfig.Paraformer.Model = path("model")
+		if config.ModelConfig.Paraformer.Model == "" {
+			return nil, fmt.Errorf("paraformer requires model")
+		}
+	case "sense_voice":
+		language := cfg.ISO639()
+		if language == "" {
+			language = "auto"
+		}
+		config.ModelConfig.SenseVoice.Model = path("model")
+		config.ModelConfig.SenseVoice.Language = language
+		config.ModelConfig.SenseVoice.UseInverseTextNormalization = 1
+		if config.ModelConfig.SenseVoice.Model == "" {
+			return nil, fmt.Errorf("sense_voice requires model")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported sherpa-onnx model_type: %q", modelType)
+	}
+
+	if config.ModelConfig.Tokens == "" {
+		return nil, fmt.Errorf("sherpa-onnx requires tokens")
+	}
+
+	return config, nil
+}
+
+func (s *SherpaOffline) TranscribeSamples(samples []float32, sampleRate int) (string, error) {
+	s.recognizer.mu.Lock()
+	defer s.recognizer.mu.Unlock()
+
+	stream := sherpa.NewOfflineStream(s.recognizer.recognizer)
+	if stream == nil {
+		return "", fmt.Errorf("failed to create sherpa-onnx offline stream")
+	}
+	defer sherpa.DeleteOfflineStream(stream)
+
+	stream.AcceptWaveform(sampleRate, samples)
+	s.recognizer.recognizer.Decode(stream)
+
+	return stream.GetResult().Text, nil
+}
+
+// Transcribe is only here to satisfy SpeechToText, the ASR always prefers TranscribeSamples
+func (s *SherpaOffline) Transcribe(audio []byte) (string, error) {
+	return "", fmt.Errorf("sherpa-onnx offline recognizer expects PCM samples, not encoded audio")
+}
+
+var (
+	_ SpeechToText      = (*SherpaOffline)(nil)
+	_ SampleTranscriber = (*SherpaOffline)(nil)
+)
@@ -0,0 +1,188 @@
+package asr
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	sherpa "github.com/k2-fsa/sherpa-onnx-go/sherpa_onnx"
+)
+
+func init() {
+	Register("sherpa_onnx_streaming", NewSherpaOnline)
+}
+
+// StreamingSpeechToText recognizes audio while the user is speaking and detects
+// the end of an utterance itself, so the ASR bypasses the VAD segmentation.
+type StreamingSpeechToText interface {
+	SpeechToText
+	NewStream() (RecognitionStream, error)
+}
+
+// RecognitionStream holds the decoding state of one connection
+type RecognitionStream interface {
+	AcceptWaveform(samples []float32, sampleRate int)
+	// Decode returns the current hypothesis and whether an endpoint was detected
+	Decode() (text string, endpoint bool)
+	Reset()
+	Close()
+}
+
+type onlineRecognizer struct {
+	mu         sync.Mutex
+	recognizer *sherpa.OnlineRecognizer
+}
+
+var (
+	onlineRecognizersMu sync.Mutex
+	onlineRecognizers   = make(map[string]*onlineRecognizer)
+)
+
+// SherpaOnline runs a sherpa-onnx streaming recognizer (transducer, paraformer, zipformer2 CTC)
+type SherpaOnline struct {
+	recognizer *onlineRecognizer
+}
+
+// NewSherpaOnline creates a streaming recognizer from the model_config params:
+//   - model_type: transducer, paraformer or zipformer2_ctc
+//   - model_dir: directory the model files are relative to
+//   - encoder, decoder, joiner (transducer), encoder, decoder (paraformer), model (zipformer2_ctc), tokens
+//   - num_threads, provider (cpu by default)
+//   - rule1_min_trailing_silence, rule2_min_trailing_silence, rule3_min_utterance_length: endpointing in seconds
+func NewSherpaOnline(cfg Config) (SpeechToText, error) {
+	config, err := newOnlineRecognizerConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("%+v", *config)
+
+	onlineRecognizersMu.Lock()
+	defer onlineRecognizersMu.Unlock()
+
+	if r, ok := onlineRecognizers[key]; ok {
+		return &SherpaOnline{recognizer: r}, nil
+	}
+
+	recognizer := sherpa.NewOnlineRecognizer(config)
+	if recognizer == nil {
+		return nil, fmt.Errorf("failed to create sherpa-onnx online recognizer, check the model files")
+	}
+
+	r := &onlineRecognizer{recognizer: recognizer}
+	onlineRecognizers[key] = r
+
+	return &SherpaOnline{recognizer: r}, nil
+}
+
+func newOnlineRecognizerConfig(cfg Config) (*sherpa.OnlineRecognizerConfig, error) {
+	path := func(key string) string {
+		name := cfg.Params[key]
+		if name == "" || filepath.IsAbs(name) {
+			return name
+		}
+		return filepath.Join(cfg.Params["model_dir"], name)
+	}
+	seconds := func(key string, fallback float32) float32 {
+		if v, err := strconv.ParseFloat(cfg.Params[key], 32); err == nil && v > 0 {
+			return float32(v)
+		}
+		return fallback
+	}
+
+	config := &sherpa.OnlineRecognizerConfig{}
+	config.FeatConfig = sherpa.FeatureConfig{SampleRate: SampleRate, FeatureDim: 80}
+	config.DecodingMethod = "greedy_search"
+	config.ModelConfig.Tokens = path("tokens")
+	config.ModelConfig.NumThreads = 1
+	config.ModelConfig.Provider = "cpu"
+	config.EnableEndpoint = 1
+	config.Rule1MinTrailingSilence = seconds("rule1_min_trailing_silence", 2.4)
+	config.Rule2MinTrailingSilence = seconds("rule2_min_trailing_silence", 0.8)
+	config.Rule3MinUtteranceLength = seconds("rule3_min_utterance_length", 20)
+
+	if n, err := strconv.Atoi(cfg.Params["num_threads"]); err == nil && n > 0 {
+		config.ModelConfig.NumThreads = n
+	}
+	if provider := cfg.Params["provider"]; provider != "" {
+		config.ModelConfig.Provider = provider
+	}
+
+	switch modelType := strings.ToLower(cfg.Params["model_type"]); modelType {
+	case "transducer", "zipformer":
+		config.ModelConfig.Transducer.Encoder = path("encoder")
+		config.ModelConfig.Transducer.Decoder = path("decoder")
+		config.ModelConfig.Transducer.Joiner = path("joiner")
+		if config.ModelConfig.Transducer.Encoder == "" || config.ModelConfig.Transducer.Decoder == "" || config.ModelConfig.Transducer.Joiner == "" {
+			return nil, fmt.Errorf("transducer requires encoder, decoder and joiner")
+		}
+	case "paraformer":
+		config.ModelConfig.Paraformer.Encoder = path("encoder")
+		config.ModelConfig.Paraformer.Decoder = path("decoder")
+		if config.ModelConfig.Paraformer.Encoder == "" || config.ModelConfig.Paraformer.Decoder == "" {
+			return nil, fmt.Errorf("paraformer requires encoder and decoder")
+		}
+	case "zipformer2_ctc":
+		config.ModelConfig.Zipformer2Ctc.Model = path("model")
+		if config.ModelConfig.Zipformer2Ctc.Model == "" {
+			return nil, fmt.Errorf("zipformer2_ctc requires model")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported sherpa-onnx streaming model_type: %q", modelType)
+	}
+
+	if config.ModelConfig.Tokens == "" {
+		return nil, fmt.Errorf("sherpa-onnx requires tokens")
+	}
+
+	return config, nil
+}
+
+func (s *SherpaOnline) NewStream() (RecognitionStream, error) {
+	stream := sherpa.NewOnlineStream(s.recognizer.recognizer)
+	if stream == nil {
+		return nil, fmt.Errorf("failed to create sherpa-onnx online stream")
+	}
+
+	return &sherpaOnlineStream{recognizer: s.recognizer, stream: stream}, nil
+}
+
+// Transcribe is only here to satisfy SpeechToText, the ASR always uses NewStream
+func (s *SherpaOnline) Transcribe(audio []byte) (string, error) {
+	return "", fmt.Errorf("sherpa-onnx streaming recognizer expects a stream, not encoded audio")
+}
+
+type sherpaOnlineStream struct {
+	recognizer *onlineRecognizer
+	stream     *sherpa.OnlineStream
+}
+
+func (s *sherpaOnlineStream) AcceptWaveform(samples []float32, sampleRate int) {
+	s.stream.AcceptWaveform(sampleRate, samples)
+}
+
+func (s *sherpaOnlineStream) Decode() (string, bool) {
+	s.recognizer.mu.Lock()
+	defer s.recognizer.mu.Unlock()
+
+	r := s.recognizer.recognizer
+	for r.IsReady(s.stream) {
+		r.Decode(s.stream)
+	}
+
+	return strings.TrimSpace(r.GetResult(s.stream).Text), r.IsEndpoint(s.stream)
+}
+
+func (s *sherpaOnlineStream) Reset() {
+	s.recognizer.mu.Lock()
+	defer s.recognizer.mu.Unlock()
+	s.recognizer.recognizer.Reset(s.stream)
+}
+
+func (s *sherpaOnlineStream) Close() {
+	sherpa.DeleteOnlineStream(s.stream)
+}
+
+var _ StreamingSpeechToText = (*SherpaOnline)(nil)
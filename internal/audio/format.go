@@ -0,0 +1,92 @@
+package audio
+
+import (
+	"fmt"
+
+	"github.com/hraban/opus"
+)
+
+// Format is the mono Opus stream sent down to a device, negotiated in the hello
+type Format struct {
+	SampleRate    int // 8000, 12000, 16000, 24000 or 48000
+	FrameDuration int // ms: 10, 20, 40 or 60
+	Application   opus.Application
+	Bitrate       int // bits per second, 0 keeps the encoder default
+	Complexity    int // 1-10, 0 keeps the encoder default
+}
+
+// DefaultFormat is what every xiaozhi firmware can play
+var DefaultFormat = Format{
+	SampleRate:    16000,
+	FrameDuration: 60,
+	Application:   opus.AppVoIP,
+}
+
+// SamplesPerFrame is the number of mono samples in one Opus frame
+func (f Format) SamplesPerFrame() int {
+	return f.SampleRate * f.FrameDuration / 1000
+}
+
+func (f Format) Validate() error {
+	switch f.SampleRate {
+	case 8000, 12000, 16000, 24000, 48000:
+	default:
+		return fmt.Errorf("unsupported opus sample rate: %d", f.SampleRate)
+	}
+
+	switch f.FrameDuration {
+	case 10, 20, 40, 60:
+	default:
+		return fmt.Errorf("unsupported opus frame duration: %dms", f.FrameDuration)
+	}
+
+	switch f.Application {
+	case opus.AppVoIP, opus.AppAudio, opus.AppRestrictedLowdelay:
+	default:
+		return fmt.Errorf("unsupported opus application: %d", f.Application)
+	}
+
+	if f.Bitrate < 0 || f.Bitrate > 0 && (f.Bitrate < 6000 || f.Bitrate > 510000) {
+		return fmt.Errorf("unsupported opus bitrate: %d", f.Bitrate)
+	}
+
+	if f.Complexity < 0 || f.Complexity > 10 {
+		return fmt.Errorf("unsupported opus complexity: %d", f.Complexity)
+	}
+
+	return nil
+}
+
+// ParseApplication maps the names used in the hello to Opus applications
+func ParseApplication(name string) (opus.Application, error) {
+	switch name {
+	case "", "voip":
+		return opus.AppVoIP, nil
+	case "audio":
+		return opus.AppAudio, nil
+	case "lowdelay", "restricted_lowdelay":
+		return opus.AppRestrictedLowdelay, nil
+	}
+	return 0, fmt.Errorf("unknown opus application: %q", name)
+}
+
+func (f Format) newEncoder() (*opus.Encoder, error) {
+	enc, err := opus.NewEncoder(f.SampleRate, TargetChannels, f.Application)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Bitrate > 0 {
+		if err := enc.SetBitrate(f.Bitrate); err != nil {
+			return nil, fmt.Errorf("failed to set opus bitrate: %w", err)
+		}
+	}
+
+	if f.Complexity > 0 {
+		if err := enc.SetComplexity(f.Complexity); err != nil {
+			return nil, fmt.Errorf("failed to set opus complexity: %w", err)
+		}
+	}
+
+	return enc, nil
+}
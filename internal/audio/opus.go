@@ -11,7 +11,6 @@ import (
 
 	"github.com/go-audio/audio"
 	"github.com/go-audio/wav"
-	"github.com/hraban/opus"
 	"github.com/lxzan/gws"
 	"github.com/zaf/resample"
 )
@@ -22,39 +21,39 @@ type MessageWriter interface {
 }
 
 const (
-	TargetSampleRate = 16000
-	TargetChannels   = 1
-	FrameDurationMs  = 60
-	// 16000 samples/sec * 0.060 sec = 960 samples
-	SamplesPerFrame = (TargetSampleRate * FrameDurationMs) / 1000
-	BurstCount      = 3
+	TargetChannels = 1
+	// frames sent ahead of playback to absorb network jitter
+	BurstCount = 3
+	// large enough for any Opus packet
+	maxPacketSize = 4000
 )
 
-// Reusable pools for high-frequency allocations
-var (
-	// Pool for the raw PCM samples (960 samples * 1 channel)
-	pcmPool = sync.Pool{
-		New: func() interface{} { return make([]int16, SamplesPerFrame*TargetChannels) },
-	}
-	// Pool for the compressed Opus output
-	encPool = sync.Pool{
-		New: func() interface{} { return make([]byte, 1024) },
+// Reusable pool for the compressed Opus output
+var encPool = sync.Pool{
+	New: func() interface{} { return make([]byte, maxPacketSize) },
+}
+
+// StreamOpus plays a WAV file on the device in the given format
+func StreamOpus(ctx context.Context, r io.ReadSeeker, format Format, socket MessageWriter) error {
+	if err := format.Validate(); err != nil {
+		return err
 	}
-)
 
-func StreamOpus(ctx context.Context, r io.ReadSeeker, socket MessageWriter) error {
 	decoder := wav.NewDecoder(r)
 	if !decoder.IsValidFile() {
 		return log.Output(2, "invalid wav header")
 	}
 
-	duration, _ := decoder.Duration()
+	// stop the feeder and encoder once the sender gives up
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	// 1. Setup the Resampling Pipe
 	// We read from the pipeReader, the resampler writes to the pipeWriter
 	pr, pw := io.Pipe()
 
-	log.Printf("Resampling from %dHz to %dHz, %d channels", decoder.SampleRate, TargetSampleRate, TargetChannels)
-	res, err := resample.New(pw, float64(decoder.SampleRate), float64(TargetSampleRate), TargetChannels, resample.I16, resample.HighQ)
+	log.Printf("Resampling from %dHz to %dHz, %d channels", decoder.SampleRate, format.SampleRate, TargetChannels)
+	res, err := resample.New(pw, float64(decoder.SampleRate), float64(format.SampleRate), TargetChannels, resample.I16, resample.HighQ)
 	if err != nil {
 		pw.Close()
 		return err
@@ -130,90 +129,87 @@ func StreamOpus(ctx context.Context, r io.ReadSeeker, socket MessageWriter) erro
 	go func() {
 		defer wg.Done()
 		defer pr.Close()
+		encodeOpus(ctx, pr, format, packetChan, errChan)
+	}()
 
-		byteBuf := make([]byte, SamplesPerFrame*2*TargetChannels) // 960 * 2 = 1920 bytes
-		enc, _ := opus.NewEncoder(TargetSampleRate, TargetChannels, opus.AppVoIP)
-
-		for {
-			// Read exactly one 60ms frame from the resampler pipe
-			n, err := io.ReadFull(pr, byteBuf)
-			isLastFrame := false
+	// Goroutine C: The closer
+	// Waits for both the feeder and encoder to finish, then closes the packetChan
+	go func() {
+		wg.Wait()
+		close(packetChan)
+	}()
 
-			if err != nil {
-				if err == io.EOF {
-					log.Println("Encoder: EOF reached")
-					return
-				}
-				if errors.Is(err, io.ErrUnexpectedEOF) {
-					log.Printf("Encoder: Partial frame at end: %d bytes (padding to full frame)", n)
-					// Pad with silence (0)
-					for i := n; i < len(byteBuf); i++ {
-						byteBuf[i] = 0
-					}
-					isLastFrame = true
-				} else {
-					log.Printf("Encoder: Read error: %v", err)
-					errChan <- err
-					return
-				}
-			}
+	// --- MAIN LOOP: Pacing & Sending ---
+	return runSender(ctx, socket, format, packetChan, errChan)
+}
 
-			pcm := pcmPool.Get().([]int16)
-			// Convert bytes back to Int16 for Opus
-			for i := 0; i < SamplesPerFrame; i++ {
-				pcm[i] = int16(binary.LittleEndian.Uint16(byteBuf[i*2 : i*2+2]))
-			}
+// encodeOpus reads frames of mono PCM at the format sample rate from r until EOF,
+// the last partial frame is padded with silence
+func encodeOpus(ctx context.Context, r io.Reader, format Format, packetChan chan<- []byte, errChan chan<- error) {
+	samplesPerFrame := format.SamplesPerFrame()
+	byteBuf := make([]byte, samplesPerFrame*2*TargetChannels)
+	pcm := make([]int16, samplesPerFrame*TargetChannels)
+	enc, err := format.newEncoder()
+	if err != nil {
+		errChan <- err
+		return
+	}
 
-			out := encPool.Get().([]byte)
-			nBytes, err := enc.Encode(pcm, out)
-			pcmPool.Put(pcm)
+	for {
+		// Read exactly one 60ms frame from the resampler pipe
+		n, err := io.ReadFull(r, byteBuf)
+		isLastFrame := false
 
-			if err != nil {
-				encPool.Put(out)
-				errChan <- err
+		if err != nil {
+			if err == io.EOF {
 				return
 			}
-
-			select {
-			case packetChan <- out[:nBytes]:
-			case <-ctx.Done():
-				encPool.Put(out)
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				// Pad with silence (0)
+				for i := n; i < len(byteBuf); i++ {
+					byteBuf[i] = 0
+				}
+				isLastFrame = true
+			} else {
+				errChan <- err
 				return
 			}
+		}
 
-			if isLastFrame {
-				log.Println("Encoder: Sent last partial frame")
-				return
-			}
+		// Convert bytes back to Int16 for Opus
+		for i := range pcm {
+			pcm[i] = int16(binary.LittleEndian.Uint16(byteBuf[i*2 : i*2+2]))
 		}
-	}()
 
-	// Goroutine C: The closer
-	// Waits for both the feeder and encoder to finish, then closes the packetChan
-	go func() {
-		wg.Wait()
-		close(packetChan)
-	}()
+		out := encPool.Get().([]byte)
+		nBytes, err := enc.Encode(pcm, out)
 
-	// --- MAIN LOOP: Pacing & Sending ---
-	start := time.Now()
-
-	defer func() {
-		elapsed := time.Since(start)
-		sleepTime := duration - elapsed
-		if sleepTime > 0 {
-			// Wait for the remaining audio duration to ensure client receives/plays everything
-			log.Printf("Sender: sleeping for %v to allow playback completion", sleepTime)
-			time.Sleep(sleepTime)
+		if err != nil {
+			encPool.Put(out)
+			errChan <- err
+			return
+		}
+
+		select {
+		case packetChan <- out[:nBytes]:
+		case <-ctx.Done():
+			encPool.Put(out)
+			return
 		}
-	}()
 
-	return runSender(ctx, socket, packetChan, errChan)
+		if isLastFrame {
+			return
+		}
+	}
 }
 
-func runSender(ctx context.Context, socket MessageWriter, packetChan chan []byte, errChan chan error) error {
-	var ticker *time.Ticker
-	count := 0
+// runSender paces packets on the device playback clock: BurstCount frames are kept in flight
+// to absorb network jitter and a stalled source (e.g. streaming TTS) simply restarts the clock.
+// It returns once the device should have played everything that was sent.
+func runSender(ctx context.Context, socket MessageWriter, format Format, packetChan chan []byte, errChan chan error) error {
+	frame := time.Duration(format.FrameDuration) * time.Millisecond
+	lead := BurstCount * frame
+	var playEnd time.Time
 
 	for {
 		select {
@@ -223,24 +219,24 @@ func runSender(ctx context.Context, socket MessageWriter, packetChan chan []byte
 			return err
 		case packet, ok := <-packetChan:
 			if !ok {
-				//log.Println("Sender: packetChan closed, done")
-				time.Sleep(time.Duration(BurstCount*FrameDurationMs) * time.Millisecond)
-				return nil
-			}
-
-			if count >= BurstCount {
-				if ticker == nil {
-					ticker = time.NewTicker(FrameDurationMs * time.Millisecond)
-					defer ticker.Stop()
-				}
 				select {
-				case <-ticker.C:
-				case <-ctx.Done():
-					return ctx.Err()
+				case err := <-errChan:
+					return err
+				default:
 				}
+
+				return sleepUntil(ctx, playEnd)
+			}
+
+			now := time.Now()
+			if playEnd.Before(now) {
+				playEnd = now
+			}
+			if err := sleepUntil(ctx, playEnd.Add(-lead)); err != nil {
+				encPool.Put(packet[:cap(packet)])
+				return err
 			}
 
-			// log.Println("send tts...")
 			if err := socket.SetDeadline(time.Now().Add(30 * time.Second)); err != nil {
 				// Check if this is a "use of closed network connection" error
 				// If so, the connection was already closed by peer
@@ -253,7 +249,24 @@ func runSender(ctx context.Context, socket MessageWriter, packetChan chan []byte
 				return err
 			}
 			encPool.Put(packet[:cap(packet)])
-			count++
+			playEnd = playEnd.Add(frame)
 		}
 	}
 }
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -54,7 +54,7 @@ func TestStreamOpus(t *testing.T) {
 
 	mock := &mockSocket{}
 
-	err = StreamOpus(ctx, f, mock)
+	err = StreamOpus(ctx, f, DefaultFormat, mock)
 	if err != nil {
 		t.Fatalf("StreamOpus failed: %v", err)
 	}
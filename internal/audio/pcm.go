@@ -4,78 +4,34 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
-	"errors"
 	"io"
 	"log"
 	"math"
 
-	"github.com/hraban/opus"
 	"github.com/lxzan/gws"
 )
 
 const DefaultSampleRate = 16000
-const SampleRate = DefaultSampleRate
-const FrameSizeMs = 60
-const FrameSize = int(float32(SampleRate) * float32(FrameSizeMs) / 1000)
 
-func StreamPcm(ctx context.Context, source io.ReadSeeker, socket *gws.Conn) error {
-	// 3. Encoder initialization
-	enc, err := opus.NewEncoder(TargetSampleRate, TargetChannels, opus.AppVoIP)
-	if err != nil {
+// StreamPcm encodes mono PCM that is already at the format sample rate and sends it
+// as fast as the socket accepts it, without pacing
+func StreamPcm(ctx context.Context, source io.Reader, format Format, socket MessageWriter) error {
+	if err := format.Validate(); err != nil {
 		return err
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	packetChan := make(chan []byte, 15) // Decoupling buffer
 	errChan := make(chan error, 1)
 
 	// GOROUTINE: The Encoding Engine
 	go func() {
 		defer close(packetChan)
-		byteBuf := make([]byte, SamplesPerFrame*2*TargetChannels)
-
-		for {
-			select {
-			case <-ctx.Done(): // Stop encoding if context is cancelled
-				return
-			default:
-				_, err := io.ReadFull(source, byteBuf)
-				if err != nil {
-					if err != io.EOF && !errors.Is(err, io.ErrUnexpectedEOF) {
-						errChan <- err
-					}
-					return
-				}
-
-				pcm := pcmPool.Get().([]int16)
-				for i := 0; i < SamplesPerFrame; i++ {
-					pcm[i] = int16(binary.LittleEndian.Uint16(byteBuf[i*2 : i*2+2]))
-				}
-
-				out := encPool.Get().([]byte)
-				nBytes, err := enc.Encode(pcm, out)
-				pcmPool.Put(pcm)
-
-				if err != nil {
-					encPool.Put(out)
-					errChan <- err
-					return
-				}
-
-				// Block until channel is ready or context is done
-				select {
-				case packetChan <- out[:nBytes]:
-				case <-ctx.Done():
-					encPool.Put(out)
-					return
-				}
-			}
-		}
+		encodeOpus(ctx, source, format, packetChan, errChan)
 	}()
 
-	// MAIN LOOP: Bursted & Paced Transmission
-	//var ticker *time.Ticker
-	count := 0
-
 	for {
 		select {
 		case <-ctx.Done():
@@ -86,26 +42,20 @@ func StreamPcm(ctx context.Context, source io.ReadSeeker, socket *gws.Conn) erro
 			if !ok {
 				log.Println("sending done.")
 				// Encoder finished and channel drained
-				return nil
+				select {
+				case err := <-errChan:
+					return err
+				default:
+					return nil
+				}
 			}
 
-			// Logic: Burst the first 3 frames (180ms) immediately, then pace the rest
-			//if count >= BurstCount {
-			//	if ticker == nil {
-			//		ticker = time.NewTicker(FrameDurationMs * time.Millisecond)
-			//		defer ticker.Stop()
-			//	}
-			//	<-ticker.C
-			//}
-
-			log.Println("sending tts...")
 			if err := socket.WriteMessage(gws.OpcodeBinary, packet); err != nil {
 				return err
 			}
 
 			// Return encoded buffer to pool (gws.WriteMessage copies the data)
 			encPool.Put(packet[:cap(packet)])
-			count++
 		}
 	}
 }
@@ -0,0 +1,129 @@
+package audio
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/zaf/resample"
+)
+
+// PcmFormat describes a 16-bit little-endian PCM source
+type PcmFormat struct {
+	SampleRate int
+	Channels   int
+}
+
+// StreamPcmOpus plays a PCM stream on the device while it is still being produced: chunks are
+// downmixed, resampled to the output rate, Opus encoded and sent paced as soon as a full frame
+// is available. It returns once the device should have played everything.
+func StreamPcmOpus(ctx context.Context, r io.Reader, source PcmFormat, format Format, socket MessageWriter) error {
+	if source.SampleRate <= 0 || source.Channels <= 0 {
+		return errors.New("invalid pcm format")
+	}
+	if err := format.Validate(); err != nil {
+		return err
+	}
+
+	// stop the feeder and encoder once the sender gives up
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+
+	var sink io.WriteCloser = nopWriteCloser{pw}
+	if source.SampleRate != format.SampleRate {
+		res, err := resample.New(pw, float64(source.SampleRate), float64(format.SampleRate), TargetChannels, resample.I16, resample.HighQ)
+		if err != nil {
+			_ = pw.Close()
+			return err
+		}
+		sink = res
+	}
+
+	packetChan := make(chan []byte, 15)
+	errChan := make(chan error, 2)
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	// Feeder: source -> downmix -> resampler
+	go func() {
+		defer wg.Done()
+
+		err := feedPcm(r, source.Channels, sink)
+		// Close flushes the resampler before the encoder sees EOF
+		_ = sink.Close()
+		_ = pw.CloseWithError(err)
+		if err != nil {
+			select {
+			case errChan <- err:
+			default:
+			}
+		}
+	}()
+
+	// Encoder: 16kHz mono -> Opus
+	go func() {
+		defer wg.Done()
+		defer pr.Close()
+		encodeOpus(ctx, pr, format, packetChan, errChan)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(packetChan)
+	}()
+
+	return runSender(ctx, socket, format, packetChan, errChan)
+}
+
+// feedPcm copies r to w as mono, averaging the channels of every sample frame
+func feedPcm(r io.Reader, channels int, w io.Writer) error {
+	frameSize := channels * 2
+	buf := make([]byte, 4096*frameSize)
+	mono := make([]byte, 4096*2)
+	pending := 0
+
+	for {
+		n, err := r.Read(buf[pending:])
+		pending += n
+
+		frames := pending / frameSize
+		if frames > 0 {
+			out := buf[:frames*frameSize]
+			if channels > 1 {
+				for i := 0; i < frames; i++ {
+					sum := 0
+					for ch := 0; ch < channels; ch++ {
+						offset := (i*channels + ch) * 2
+						sum += int(int16(binary.LittleEndian.Uint16(buf[offset:])))
+					}
+					binary.LittleEndian.PutUint16(mono[i*2:], uint16(int16(sum/channels)))
+				}
+				out = mono[:frames*2]
+			}
+
+			if _, werr := w.Write(out); werr != nil {
+				return werr
+			}
+
+			// keep an incomplete sample frame for the next read
+			pending = copy(buf, buf[frames*frameSize:pending])
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
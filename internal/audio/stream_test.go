@@ -0,0 +1,92 @@
+package audio
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"math"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestFeedPcmDownmix(t *testing.T) {
+	stereo := make([]byte, 0, 16)
+	for _, s := range []int16{100, 300, -200, -400, 32767, 32767, 0, 10} {
+		stereo = binary.LittleEndian.AppendUint16(stereo, uint16(s))
+	}
+
+	var out bytes.Buffer
+	// one byte reads split every sample frame
+	if err := feedPcm(iotest.OneByteReader(bytes.NewReader(stereo)), 2, &out); err != nil {
+		t.Fatalf("feedPcm: %v", err)
+	}
+
+	want := []int16{200, -300, 32767, 5}
+	got := out.Bytes()
+	if len(got) != len(want)*2 {
+		t.Fatalf("got %d bytes, want %d", len(got), len(want)*2)
+	}
+	for i, w := range want {
+		if s := int16(binary.LittleEndian.Uint16(got[i*2:])); s != w {
+			t.Errorf("sample %d = %d, want %d", i, s, w)
+		}
+	}
+}
+
+func TestStreamPcmOpus(t *testing.T) {
+	// 300ms of a 440Hz tone at 24kHz, as OpenAI and Gemini speech is delivered
+	const sampleRate = 24000
+	var pcm []byte
+	for i := 0; i < sampleRate*3/10; i++ {
+		v := int16(8000 * math.Sin(2*math.Pi*440*float64(i)/sampleRate))
+		pcm = binary.LittleEndian.AppendUint16(pcm, uint16(v))
+	}
+
+	tests := []struct {
+		name   string
+		format Format
+		min    int
+		max    int
+	}{
+		// 300ms is five 60ms frames, resampler latency may add one
+		{"default", DefaultFormat, 5, 6},
+		{"24kHz 20ms", Format{SampleRate: 24000, FrameDuration: 20, Application: DefaultFormat.Application, Complexity: 5}, 15, 16},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			mock := &mockSocket{}
+			// half-chunks mimic a provider streaming audio in small pieces
+			r := iotest.HalfReader(bytes.NewReader(pcm))
+			if err := StreamPcmOpus(ctx, r, PcmFormat{SampleRate: sampleRate, Channels: 1}, tt.format, mock); err != nil {
+				t.Fatalf("StreamPcmOpus failed: %v", err)
+			}
+
+			if n := len(mock.packets); n < tt.min || n > tt.max {
+				t.Errorf("got %d packets, want %d to %d", n, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestFormatValidate(t *testing.T) {
+	if err := DefaultFormat.Validate(); err != nil {
+		t.Fatalf("DefaultFormat.Validate() = %v", err)
+	}
+
+	invalid := []Format{
+		{SampleRate: 44100, FrameDuration: 60, Application: DefaultFormat.Application},
+		{SampleRate: 16000, FrameDuration: 30, Application: DefaultFormat.Application},
+		{SampleRate: 16000, FrameDuration: 60, Application: DefaultFormat.Application, Bitrate: 100},
+		{SampleRate: 16000, FrameDuration: 60, Application: DefaultFormat.Application, Complexity: 11},
+	}
+	for _, f := range invalid {
+		if err := f.Validate(); err == nil {
+			t.Errorf("Validate(%+v) succeeded, want an error", f)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package audio
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"os"
 
@@ -46,7 +47,7 @@ func Float32ToWavBytes(samples []float32, sampleRate int) ([]byte, error) {
 	}
 
 	enc := wav.NewEncoder(tempFile,
-		SampleRate,
+		sampleRate,
 		16, // 16-bit PCM
 		1,  // mono
 		1,
@@ -65,18 +66,19 @@ func Float32ToWavBytes(samples []float32, sampleRate int) ([]byte, error) {
 	return os.ReadFile(tempFile.Name())
 }
 
+// PCMToWavBytes wraps 16-bit little-endian mono PCM into a WAV file
 func PCMToWavBytes(samples []byte, sampleRate int) ([]byte, error) {
 	buf := &audio.IntBuffer{
 		Format: &audio.Format{
 			NumChannels: 1,
 			SampleRate:  sampleRate,
 		},
-		Data: make([]int, len(samples)),
+		Data: make([]int, len(samples)/2),
 	}
 
-	// Convert byte to 16-bit (2 bytes)
-	for i, sample := range samples {
-		buf.Data[i] = int(sample)
+	// Convert byte pairs to 16-bit samples
+	for i := range buf.Data {
+		buf.Data[i] = int(int16(binary.LittleEndian.Uint16(samples[i*2:])))
 	}
 
 	tempFile, err := os.CreateTemp("", "tts-*.wav")
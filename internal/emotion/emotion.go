@@ -0,0 +1,114 @@
+// Package emotion maps the emoji a model starts its reply with to the emotions xiaozhi firmware can display.
+package emotion
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Neutral is used when a reply carries no recognizable emotion
+const Neutral = "neutral"
+
+// emojis lists the emotions supported by the firmware, in the order offered to the model
+var emojis = []struct {
+	emoji   string
+	emotion string
+}{
+	{"😶", "neutral"},
+	{"🙂", "happy"},
+	{"😆", "laughing"},
+	{"😂", "funny"},
+	{"😔", "sad"},
+	{"😠", "angry"},
+	{"😭", "crying"},
+	{"😍", "loving"},
+	{"😳", "embarrassed"},
+	{"😲", "surprised"},
+	{"😱", "shocked"},
+	{"🤔", "thinking"},
+	{"😉", "winking"},
+	{"😎", "cool"},
+	{"😌", "relaxed"},
+	{"🤤", "delicious"},
+	{"😘", "kissy"},
+	{"😏", "confident"},
+	{"😴", "sleepy"},
+	{"😜", "silly"},
+	{"🙄", "confused"},
+}
+
+// related emojis models commonly use instead of the canonical ones
+var aliases = map[string]string{
+	"😀": "happy", "😃": "happy", "😄": "happy", "😊": "happy", "☺": "happy", "😁": "laughing",
+	"🤣": "funny", "😢": "sad", "😞": "sad", "😡": "angry", "🥰": "loving", "❤": "loving",
+	"😮": "surprised", "😯": "surprised", "😨": "shocked", "😇": "relaxed", "😋": "delicious",
+	"😗": "kissy", "😪": "sleepy", "😝": "silly", "😛": "silly", "😕": "confused", "🤨": "confused",
+}
+
+// PromptHint asks the model to tag every reply with one emotion emoji
+func PromptHint() string {
+	var b strings.Builder
+	b.WriteString("Start every reply with exactly one emoji that matches your emotion, chosen from: ")
+	for i, e := range emojis {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString(e.emoji)
+	}
+	b.WriteString(". Do not use any other emoji.")
+	return b.String()
+}
+
+// Detect returns the emotion of the first known emoji in text and whether one was found
+func Detect(text string) (string, bool) {
+	for i, r := range text {
+		if !IsEmoji(r) {
+			continue
+		}
+
+		candidate := string(r)
+		for _, e := range emojis {
+			if strings.HasPrefix(text[i:], e.emoji) {
+				return e.emotion, true
+			}
+		}
+		if emotion, ok := aliases[candidate]; ok {
+			return emotion, true
+		}
+	}
+
+	return "", false
+}
+
+// Strip removes emoji so text-to-speech engines do not read them out
+func Strip(text string) string {
+	if strings.IndexFunc(text, IsEmoji) < 0 {
+		return text
+	}
+
+	var b strings.Builder
+	b.Grow(len(text))
+	for _, r := range text {
+		if IsEmoji(r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return strings.Join(strings.FieldsFunc(b.String(), unicode.IsSpace), " ")
+}
+
+// IsEmoji reports pictographs, dingbats and the joiners / selectors used to compose them
+func IsEmoji(r rune) bool {
+	switch {
+	case r >= 0x1F000 && r <= 0x1FAFF: // emoticons, pictographs, transport, flags, supplemental symbols
+		return true
+	case r >= 0x2600 && r <= 0x27BF: // misc symbols and dingbats
+		return true
+	case r == 0x200D || r == 0xFE0F || r == 0x20E3: // ZWJ, variation selector, keycap
+		return true
+	case r >= 0xE0020 && r <= 0xE007F: // tag sequences
+		return true
+	}
+	return false
+}
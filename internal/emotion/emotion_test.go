@@ -0,0 +1,41 @@
+package emotion
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		text    string
+		emotion string
+		found   bool
+	}{
+		{"😆 That is hilarious!", "laughing", true},
+		{"Sure thing 😎", "cool", true},
+		{"😊 Xin chào!", "happy", true},
+		{"❤️ I love it", "loving", true},
+		{"No emoji here.", "", false},
+		{"你好 🤔", "thinking", true},
+	}
+
+	for _, tt := range tests {
+		emotion, found := Detect(tt.text)
+		if emotion != tt.emotion || found != tt.found {
+			t.Errorf("Detect(%q) = %q, %v, want %q, %v", tt.text, emotion, found, tt.emotion, tt.found)
+		}
+	}
+}
+
+func TestStrip(t *testing.T) {
+	tests := map[string]string{
+		"😆 That is hilarious!": "That is hilarious!",
+		"Thumbs up 👍🏽 for you": "Thumbs up for you",
+		"❤️ Yêu quá":           "Yêu quá",
+		"今天天气很好。":              "今天天气很好。",
+		"family 👨‍👩‍👧 time":    "family time",
+	}
+
+	for in, want := range tests {
+		if got := Strip(in); got != want {
+			t.Errorf("Strip(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
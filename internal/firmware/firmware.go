@@ -0,0 +1,79 @@
+package firmware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrLinkExpired      = errors.New("download link expired")
+	ErrInvalidSignature = errors.New("download link signature does not match")
+)
+
+// Build is a published firmware image
+type Build struct {
+	ID      string
+	Board   string
+	Version string
+}
+
+// Newest returns the newest build for the board that is newer than current.
+// Pre-releases are only offered to devices already running one.
+func Newest(builds []Build, board, current string) (Build, bool) {
+	return newest(builds, board, current, func(Build) bool { return false })
+}
+
+// newest is Newest where staged reports the builds that may be pre-releases anyway, e.g. offered through a rollout
+func newest(builds []Build, board, current string, staged func(Build) bool) (Build, bool) {
+	var best Build
+	found := false
+	for _, b := range builds {
+		if b.Board != board || !Valid(b.Version) || Compare(b.Version, current) <= 0 {
+			continue
+		}
+		if Prerelease(b.Version) && !Prerelease(current) && !staged(b) {
+			continue
+		}
+		if !found || Compare(b.Version, best.Version) > 0 {
+			best, found = b, true
+		}
+	}
+
+	return best, found
+}
+
+// Sign returns the signature of a download link of build id for a device, it stops working at expires.
+// The device is signed too so that downloads can be attributed to a rollout.
+func Sign(secret, id, device string, expires time.Time) string {
+	return base64.RawURLEncoding.EncodeToString(signature(secret, id, device, expires.Unix()))
+}
+
+// Verify checks a download link made by Sign, expires is the unix time of the link
+func Verify(secret, id, device, expires, sig string, now time.Time) error {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	given, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(given, signature(secret, id, device, unix)) {
+		return ErrInvalidSignature
+	}
+
+	if now.Unix() > unix {
+		return ErrLinkExpired
+	}
+
+	return nil
+}
+
+func signature(secret, id, device string, expires int64) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("firmware|" + id + "|" + device + "|" + strconv.FormatInt(expires, 10)))
+
+	return mac.Sum(nil)
+}
@@ -0,0 +1,112 @@
+package firmware
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.6.2", "1.6.2", 0},
+		{"v1.6.2", "1.6.2", 0},
+		{"1.6", "1.6.0", 0},
+		{"1.6.10", "1.6.9", 1},
+		{"1.7.0", "1.10.0", -1},
+		{"2.0.0", "1.99.99", 1},
+		{"1.7.0-rc.1", "1.7.0", -1},
+		{"1.7.0-rc.2", "1.7.0-rc.10", -1},
+		{"1.7.0-alpha", "1.7.0-1", 1},
+		{"1.7.0-rc", "1.7.0-rc.1", -1},
+		{"1.7.0+build.5", "1.7.0", 0},
+	}
+
+	for _, tt := range tests {
+		if got := Compare(tt.a, tt.b); got != tt.want {
+			t.Errorf("Compare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	for v, want := range map[string]bool{
+		"1.6.2":      true,
+		"v2.0":       true,
+		"1.7.0-rc.1": true,
+		"":           false,
+		"latest":     false,
+		"1.2.3.4":    false,
+		"1.x.0":      false,
+	} {
+		if got := Valid(v); got != want {
+			t.Errorf("Valid(%q) = %v, want %v", v, got, want)
+		}
+	}
+}
+
+func TestNewest(t *testing.T) {
+	builds := []Build{
+		{ID: "a", Board: "bread-compact-wifi", Version: "1.6.2"},
+		{ID: "b", Board: "bread-compact-wifi", Version: "1.7.0"},
+		{ID: "c", Board: "bread-compact-wifi", Version: "1.7.1-rc.1"},
+		{ID: "d", Board: "esp-box-3", Version: "2.0.0"},
+		{ID: "e", Board: "bread-compact-wifi", Version: "broken"},
+	}
+
+	tests := []struct {
+		name, board, current, want string
+	}{
+		{"newest stable of board", "bread-compact-wifi", "1.6.0", "b"},
+		{"pre-release device", "bread-compact-wifi", "1.7.1-rc.0", "c"},
+		{"up to date", "bread-compact-wifi", "1.7.0", ""},
+		{"ahead", "bread-compact-wifi", "1.7.1", ""},
+		{"other board", "esp-box-3", "1.0.0", "d"},
+		{"unknown board", "m5stack", "1.0.0", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Newest(builds, tt.board, tt.current)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("Newest() = %q, want none", got.ID)
+				}
+				return
+			}
+			if !ok || got.ID != tt.want {
+				t.Fatalf("Newest() = %q, want %q", got.ID, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	const secret = "s3cr3t"
+	now := time.Unix(1737215340, 0)
+	expires := now.Add(time.Hour)
+	sig := Sign(secret, "fw1", "aa:bb:cc:dd:ee:ff", expires)
+
+	tests := []struct {
+		name, id, device, expires, sig string
+		want                           error
+	}{
+		{"valid", "fw1", "aa:bb:cc:dd:ee:ff", "1737218940", sig, nil},
+		{"other build", "fw2", "aa:bb:cc:dd:ee:ff", "1737218940", sig, ErrInvalidSignature},
+		{"other device", "fw1", "aa:bb:cc:dd:ee:00", "1737218940", sig, ErrInvalidSignature},
+		{"extended", "fw1", "aa:bb:cc:dd:ee:ff", "1737222540", sig, ErrInvalidSignature},
+		{"bad expires", "fw1", "aa:bb:cc:dd:ee:ff", "soon", sig, ErrInvalidSignature},
+		{"bad encoding", "fw1", "aa:bb:cc:dd:ee:ff", "1737218940", "!!!", ErrInvalidSignature},
+		{"expired", "fw1", "aa:bb:cc:dd:ee:ff", "1737211740", Sign(secret, "fw1", "aa:bb:cc:dd:ee:ff", now.Add(-time.Hour)), ErrLinkExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(secret, tt.id, tt.device, tt.expires, tt.sig, now); !errors.Is(err, tt.want) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
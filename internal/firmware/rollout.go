@@ -0,0 +1,137 @@
+package firmware
+
+import (
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"time"
+)
+
+const (
+	RolloutActive    = "active"
+	RolloutPaused    = "paused"
+	RolloutHalted    = "halted"
+	RolloutCompleted = "completed"
+
+	DeviceOffered    = "offered"
+	DeviceDownloaded = "downloaded"
+	DeviceUpdated    = "updated"
+	DeviceFailed     = "failed"
+)
+
+// Rollout stages a build, while it is active only the devices of its cohort are offered the build.
+// A completed rollout releases the build to every device, a paused or halted one to none.
+type Rollout struct {
+	ID      string
+	BuildID string
+	Status  string
+	// Percent of the devices, picked by a stable hash so raising it keeps the earlier cohort
+	Percent int
+	// Tags limit the cohort to devices carrying one of them, empty means every device
+	Tags []string
+}
+
+// Device is what the cohort selection knows about a device
+type Device struct {
+	ID   string
+	Tags []string
+	// Failed holds the rollouts the device failed, their build is not offered again
+	Failed map[string]bool
+}
+
+// Offer is a build to install, RolloutID is empty when the build is released to every device
+type Offer struct {
+	Build     Build
+	RolloutID string
+}
+
+// Includes reports whether the device is part of the rollout cohort
+func (r Rollout) Includes(d Device) bool {
+	if d.Failed[r.ID] {
+		return false
+	}
+
+	if len(r.Tags) > 0 && !slices.ContainsFunc(d.Tags, func(tag string) bool { return slices.Contains(r.Tags, tag) }) {
+		return false
+	}
+
+	return bucket(r.ID, d.ID) < r.Percent
+}
+
+// Pick returns the newest build newer than current the device may install.
+// Builds without any rollout are released to every device.
+func Pick(builds []Build, rollouts []Rollout, device Device, board, current string) (Offer, bool) {
+	staged := make(map[string][]Rollout)
+	for _, r := range rollouts {
+		staged[r.BuildID] = append(staged[r.BuildID], r)
+	}
+
+	var eligible []Build
+	via := make(map[string]string)
+	for _, b := range builds {
+		rolloutID, ok := release(staged[b.ID], device)
+		if ok {
+			eligible = append(eligible, b)
+			via[b.ID] = rolloutID
+		}
+	}
+
+	// a rollout may stage a pre-release, its cohort opted in
+	best, ok := newest(eligible, board, current, func(b Build) bool { return via[b.ID] != "" })
+	if !ok {
+		return Offer{}, false
+	}
+
+	return Offer{Build: best, RolloutID: via[best.ID]}, true
+}
+
+// release reports whether a build with these rollouts is offered to the device and through which rollout
+func release(rollouts []Rollout, device Device) (string, bool) {
+	if len(rollouts) == 0 {
+		return "", true
+	}
+
+	for _, r := range rollouts {
+		if r.Status == RolloutCompleted {
+			return "", true
+		}
+	}
+
+	for _, r := range rollouts {
+		if r.Status == RolloutActive && r.Includes(device) {
+			return r.ID, true
+		}
+	}
+
+	return "", false
+}
+
+// Judge moves a device along a rollout from the version it reported on OTA check since the offer,
+// or since the download once it took the update. reported is empty when it has not checked in since.
+func Judge(status, target, reported string, downloaded, now time.Time, timeout time.Duration) (string, string) {
+	if reported != "" && Compare(reported, target) == 0 {
+		return DeviceUpdated, ""
+	}
+
+	if status != DeviceDownloaded {
+		return status, ""
+	}
+
+	if reported != "" {
+		return DeviceFailed, fmt.Sprintf("reported %s after the download", reported)
+	}
+
+	if now.Sub(downloaded) > timeout {
+		return DeviceFailed, fmt.Sprintf("no check-in within %s of the download", timeout)
+	}
+
+	return status, ""
+}
+
+// bucket places a device in 0-99, per rollout so that every rollout starts with other devices
+func bucket(rolloutID, deviceID string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(rolloutID + "|" + deviceID))
+
+	return int(h.Sum32() % 100)
+}
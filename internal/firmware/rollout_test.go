@@ -0,0 +1,134 @@
+package firmware
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRolloutIncludes(t *testing.T) {
+	device := Device{ID: "aa:bb:cc:dd:ee:ff", Tags: []string{"beta", "lab"}}
+
+	tests := []struct {
+		name    string
+		rollout Rollout
+		device  Device
+		want    bool
+	}{
+		{"everyone", Rollout{ID: "r1", Percent: 100}, device, true},
+		{"nobody", Rollout{ID: "r1", Percent: 0}, device, false},
+		{"matching tag", Rollout{ID: "r1", Percent: 100, Tags: []string{"beta"}}, device, true},
+		{"other tag", Rollout{ID: "r1", Percent: 100, Tags: []string{"canary"}}, device, false},
+		{"untagged device", Rollout{ID: "r1", Percent: 100, Tags: []string{"beta"}}, Device{ID: "x"}, false},
+		{"failed before", Rollout{ID: "r1", Percent: 100}, Device{ID: "x", Failed: map[string]bool{"r1": true}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rollout.Includes(tt.device); got != tt.want {
+				t.Fatalf("Includes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRolloutCohortGrows(t *testing.T) {
+	small := Rollout{ID: "r1", Percent: 10}
+	large := Rollout{ID: "r1", Percent: 50}
+
+	members := 0
+	for i := range 1000 {
+		d := Device{ID: fmt.Sprintf("device-%d", i)}
+		if small.Includes(d) {
+			members++
+			if !large.Includes(d) {
+				t.Fatalf("%s left the cohort when the rollout grew", d.ID)
+			}
+		}
+	}
+
+	if members < 50 || members > 150 {
+		t.Fatalf("10%% cohort has %d of 1000 devices", members)
+	}
+}
+
+func TestPick(t *testing.T) {
+	builds := []Build{
+		{ID: "stable", Board: "bread-compact-wifi", Version: "1.6.2"},
+		{ID: "staged", Board: "bread-compact-wifi", Version: "1.7.0"},
+	}
+	device := Device{ID: "aa:bb:cc:dd:ee:ff", Tags: []string{"beta"}}
+
+	tests := []struct {
+		name      string
+		rollouts  []Rollout
+		device    Device
+		want      string
+		rolloutID string
+	}{
+		{"no rollouts", nil, device, "staged", ""},
+		{"in cohort", []Rollout{{ID: "r1", BuildID: "staged", Status: RolloutActive, Percent: 100}}, device, "staged", "r1"},
+		{"out of cohort", []Rollout{{ID: "r1", BuildID: "staged", Status: RolloutActive, Percent: 0}}, device, "stable", ""},
+		{"halted", []Rollout{{ID: "r1", BuildID: "staged", Status: RolloutHalted, Percent: 100}}, device, "stable", ""},
+		{"paused", []Rollout{{ID: "r1", BuildID: "staged", Status: RolloutPaused, Percent: 100}}, device, "stable", ""},
+		{"completed", []Rollout{{ID: "r1", BuildID: "staged", Status: RolloutCompleted}}, device, "staged", ""},
+		{"second cohort", []Rollout{
+			{ID: "r1", BuildID: "staged", Status: RolloutActive, Percent: 100, Tags: []string{"lab"}},
+			{ID: "r2", BuildID: "staged", Status: RolloutActive, Percent: 100, Tags: []string{"beta"}},
+		}, device, "staged", "r2"},
+		{"failed", []Rollout{{ID: "r1", BuildID: "staged", Status: RolloutActive, Percent: 100}},
+			Device{ID: device.ID, Failed: map[string]bool{"r1": true}}, "stable", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Pick(builds, tt.rollouts, tt.device, "bread-compact-wifi", "1.6.0")
+			if !ok || got.Build.ID != tt.want || got.RolloutID != tt.rolloutID {
+				t.Fatalf("Pick() = %+v, %v, want %q through %q", got, ok, tt.want, tt.rolloutID)
+			}
+		})
+	}
+
+	candidate := append(builds, Build{ID: "rc", Board: "bread-compact-wifi", Version: "1.8.0-rc.1"})
+	if got, _ := Pick(candidate, nil, device, "bread-compact-wifi", "1.6.0"); got.Build.ID != "staged" {
+		t.Fatalf("Pick() = %q, want the stable build over an unstaged pre-release", got.Build.ID)
+	}
+	staged := []Rollout{{ID: "r1", BuildID: "rc", Status: RolloutActive, Percent: 100}}
+	if got, _ := Pick(candidate, staged, device, "bread-compact-wifi", "1.6.0"); got.Build.ID != "rc" || got.RolloutID != "r1" {
+		t.Fatalf("Pick() = %+v, want the pre-release of the rollout", got)
+	}
+
+	if got, ok := Pick(builds, nil, device, "bread-compact-wifi", "1.7.0"); ok {
+		t.Fatalf("Pick() = %+v, want none when up to date", got)
+	}
+}
+
+func TestJudge(t *testing.T) {
+	downloaded := time.Unix(1737215340, 0)
+	timeout := 30 * time.Minute
+
+	tests := []struct {
+		name, status, reported string
+		now                    time.Time
+		want                   string
+	}{
+		{"updated", DeviceDownloaded, "1.7.0", downloaded.Add(time.Minute), DeviceUpdated},
+		{"updated without download", DeviceOffered, "v1.7", downloaded, DeviceUpdated},
+		{"kept old version", DeviceDownloaded, "1.6.2", downloaded.Add(time.Minute), DeviceFailed},
+		{"silent", DeviceDownloaded, "", downloaded.Add(time.Hour), DeviceFailed},
+		{"rebooting", DeviceDownloaded, "", downloaded.Add(time.Minute), DeviceDownloaded},
+		{"declined offer", DeviceOffered, "1.6.2", downloaded.Add(time.Hour), DeviceOffered},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := Judge(tt.status, "1.7.0", tt.reported, downloaded, tt.now, timeout)
+			if got != tt.want {
+				t.Fatalf("Judge() = %q (%s), want %q", got, reason, tt.want)
+			}
+			if (got == DeviceFailed) != (reason != "") {
+				t.Fatalf("Judge() reason = %q for %q", reason, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Package firmware picks the OTA build offered to a device and signs its download URL.
+package firmware
+
+import (
+	"cmp"
+	"strconv"
+	"strings"
+)
+
+// Compare orders two semantic versions like `1.6.2` or `v1.7.0-rc.1`, it returns -1, 0 or +1.
+// Missing minor and patch numbers count as 0, build metadata is ignored.
+func Compare(a, b string) int {
+	coreA, preA := splitVersion(a)
+	coreB, preB := splitVersion(b)
+
+	for i := range max(len(coreA), len(coreB)) {
+		if c := compareNumbers(part(coreA, i), part(coreB, i)); c != 0 {
+			return c
+		}
+	}
+
+	// a pre-release is older than its release
+	switch {
+	case preA == "" && preB == "":
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+
+	idsA, idsB := strings.Split(preA, "."), strings.Split(preB, ".")
+	for i := range min(len(idsA), len(idsB)) {
+		if c := compareIdentifiers(idsA[i], idsB[i]); c != 0 {
+			return c
+		}
+	}
+
+	return cmp.Compare(len(idsA), len(idsB))
+}
+
+// Valid reports whether v is a version Compare understands
+func Valid(v string) bool {
+	numbers, _ := splitVersion(v)
+	if len(numbers) == 0 || len(numbers) > 3 {
+		return false
+	}
+
+	for _, n := range numbers {
+		if _, err := strconv.ParseUint(n, 10, 64); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Prerelease reports whether v is a pre-release like `1.7.0-rc.1`
+func Prerelease(v string) bool {
+	_, pre := splitVersion(v)
+	return pre != ""
+}
+
+func splitVersion(v string) (numbers []string, pre string) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	v, _, _ = strings.Cut(v, "+")
+	v, pre, _ = strings.Cut(v, "-")
+	if v == "" {
+		return nil, pre
+	}
+
+	return strings.Split(v, "."), pre
+}
+
+func part(numbers []string, i int) string {
+	if i < len(numbers) {
+		return numbers[i]
+	}
+
+	return "0"
+}
+
+func compareNumbers(a, b string) int {
+	x, errA := strconv.ParseUint(a, 10, 64)
+	y, errB := strconv.ParseUint(b, 10, 64)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+
+	return cmp.Compare(x, y)
+}
+
+// compareIdentifiers orders pre-release identifiers, numeric ones are older than alphanumeric ones
+func compareIdentifiers(a, b string) int {
+	_, errA := strconv.ParseUint(a, 10, 64)
+	_, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		return compareNumbers(a, b)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
@@ -19,11 +19,12 @@ type agentConnectRequest struct {
 	token      string
 	macAddress string
 	clientId   string
+	ip         string
 }
 
 // handleAgentConnect is the HTTP handler for an agent's connection request.
 func (h *Hub) handleAgentConnect(e *core.RequestEvent) error {
-	agentRequest := agentConnectRequest{req: e.Request, res: e.Response, hub: h}
+	agentRequest := agentConnectRequest{req: e.Request, res: e.Response, hub: h, ip: e.RealIP()}
 	_ = agentRequest.agentConnect()
 	return nil
 }
@@ -35,6 +36,12 @@ func (acr *agentConnectRequest) agentConnect() (err error) {
 		return acr.sendResponseError(acr.res, http.StatusBadRequest, "missing credentials")
 	}
 
+	// Verify the token issued by /xiaozhi/ota so that a known MAC address alone is not enough
+	if err := acr.hub.services.Auth.VerifyDeviceToken(header.Token, header.ClientID, header.MacAddress); err != nil {
+		acr.hub.Logger().Warn("device token rejected", "error", err, "mac", header.MacAddress, "clientId", header.ClientID)
+		return acr.sendResponseError(acr.res, http.StatusUnauthorized, err.Error())
+	}
+
 	// Validate device
 	deviceID, err := acr.hub.services.Device.ValidateDevice(header.MacAddress)
 	if err != nil {
@@ -66,12 +73,24 @@ func (acr *agentConnectRequest) initWsConn(conn *gws.Conn, deviceID string) (err
 	}
 
 	logger := acr.hub.Logger().With("device", deviceID).With("sessionId", sessionID)
-	client := ws.NewClient(conn, deviceID, sessionID, acr.hub.services, logger)
+	client, err := ws.NewClient(conn, deviceID, sessionID, acr.hub.services, logger)
+	if err != nil {
+		logger.Error("failed to create client", "error", err)
+		_ = conn.WriteClose(1011, []byte(err.Error()))
+		return err
+	}
 	wsConn := ws.NewWsConnection(conn, client)
 
 	// must set wsConn in connection store before the read loop
 	conn.Session().Store("wsConn", wsConn)
 
+	acr.hub.clients.Register(client)
+
+	// presence is informational, a failure must not drop the device
+	if err := wsConn.TrackPresence(acr.ip); err != nil {
+		logger.Error("failed to record device connection", "error", err)
+	}
+
 	// make sure connection is closed if there is an error
 	defer func() {
 		if err != nil {
@@ -109,7 +128,8 @@ func (acr *agentConnectRequest) validateAgentHeaders(headers http.Header) (devic
 	}
 
 	// todo validate mac address
-	if macAddress == "" || clientID == "" || token == "" {
+	// the token itself is checked by the auth service so that it can report a precise reason
+	if macAddress == "" || clientID == "" {
 		return deviceInfo{}, errors.New("")
 	}
 
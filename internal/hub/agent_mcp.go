@@ -0,0 +1,293 @@
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/phamviet/xiaozhi-hub/internal/hub/services"
+	"github.com/phamviet/xiaozhi-hub/internal/hub/ws"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	agentMCPServerName = "xiaozhi-hub"
+
+	defaultHistoryLimit = 20
+	maxHistoryLimit     = 100
+)
+
+// agentMCPHandlers keeps one streamable HTTP handler per agent, MCP sessions never cross agents
+var agentMCPHandlers sync.Map // agent id -> *gomcp.StreamableHTTPHandler
+
+type speakInput struct {
+	Text   string `json:"text" jsonschema:"what the devices say"`
+	Device string `json:"device,omitempty" jsonschema:"id of the device, every connected device of the agent when empty"`
+}
+
+type speakOutput struct {
+	Devices []string `json:"devices" jsonschema:"ids of the devices that spoke"`
+}
+
+type deviceInfo struct {
+	ID         string   `json:"id"`
+	MacAddress string   `json:"mac_address"`
+	Board      string   `json:"board,omitempty"`
+	Online     bool     `json:"online"`
+	Tools      []string `json:"tools,omitempty"`
+}
+
+type listDevicesOutput struct {
+	Devices []deviceInfo `json:"devices"`
+}
+
+type historyInput struct {
+	Limit int `json:"limit,omitempty" jsonschema:"number of messages, 20 by default and 100 at most"`
+}
+
+type historyOutput struct {
+	Messages []services.HistoryEntry `json:"messages"`
+}
+
+type callDeviceToolInput struct {
+	Device    string         `json:"device" jsonschema:"id of a connected device"`
+	Name      string         `json:"name" jsonschema:"tool name on the device"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+}
+
+// registerAgentMCPRoutes exposes every agent as an MCP server for external AI clients.
+// The owner issues the bearer token, the MCP endpoint itself only accepts that token.
+func (h *Hub) registerAgentMCPRoutes(se *core.ServeEvent) {
+	token := se.Router.Group("/api/agents/{id}/mcp-token")
+	token.Bind(apis.RequireAuth())
+
+	token.POST("", func(e *core.RequestEvent) error {
+		agent, err := h.ownedAgent(e)
+		if err != nil {
+			return err
+		}
+
+		agentToken, err := h.services.Auth.RotateAgentToken(agent.Id)
+		if err != nil {
+			return e.InternalServerError("failed to issue token", err)
+		}
+
+		return e.JSON(http.StatusOK, map[string]string{
+			"token": agentToken,
+			"url":   strings.TrimSuffix(e.App.Settings().Meta.AppURL, "/") + "/api/agents/" + agent.Id + "/mcp",
+		})
+	})
+
+	token.DELETE("", func(e *core.RequestEvent) error {
+		agent, err := h.ownedAgent(e)
+		if err != nil {
+			return err
+		}
+
+		if err := h.services.Auth.RevokeAgentToken(agent.Id); err != nil {
+			return e.InternalServerError("failed to revoke token", err)
+		}
+
+		return e.NoContent(http.StatusNoContent)
+	})
+
+	se.Router.Any("/api/agents/{id}/mcp", func(e *core.RequestEvent) error {
+		agentID := e.Request.PathValue("id")
+		bearer, _ := strings.CutPrefix(e.Request.Header.Get("Authorization"), "Bearer ")
+		if err := h.services.Auth.VerifyAgentToken(agentID, bearer); err != nil {
+			return e.UnauthorizedError("invalid agent token", err)
+		}
+
+		handler, _ := agentMCPHandlers.LoadOrStore(agentID, gomcp.NewStreamableHTTPHandler(func(*http.Request) *gomcp.Server {
+			return h.agentMCPServer(agentID)
+		}, nil))
+		handler.(*gomcp.StreamableHTTPHandler).ServeHTTP(e.Response, e.Request)
+
+		return nil
+	})
+}
+
+func (h *Hub) ownedAgent(e *core.RequestEvent) (*core.Record, error) {
+	agent, err := e.App.FindRecordById("ai_agent", e.Request.PathValue("id"))
+	if err != nil || (!e.HasSuperuserAuth() && agent.GetString("user") != e.Auth.Id) {
+		return nil, e.NotFoundError("agent not found", err)
+	}
+
+	return agent, nil
+}
+
+// agentMCPServer builds the server of a new MCP session, the tools of the devices connected at that time are proxied
+func (h *Hub) agentMCPServer(agentID string) *gomcp.Server {
+	server := gomcp.NewServer(&gomcp.Implementation{Name: agentMCPServerName}, nil)
+
+	gomcp.AddTool(server, &gomcp.Tool{Name: "speak", Description: "Say a text on the agent devices, interrupting what they are saying"},
+		func(ctx context.Context, req *gomcp.CallToolRequest, input speakInput) (*gomcp.CallToolResult, speakOutput, error) {
+			if strings.TrimSpace(input.Text) == "" {
+				return nil, speakOutput{}, errors.New("text is required")
+			}
+
+			clients, err := h.agentClients(agentID, input.Device)
+			if err != nil {
+				return nil, speakOutput{}, err
+			}
+
+			var (
+				mu     sync.Mutex
+				wg     sync.WaitGroup
+				output speakOutput
+				errs   []error
+			)
+			for _, c := range clients {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					err := c.Announce(ctx, input.Text)
+					mu.Lock()
+					defer mu.Unlock()
+					if err != nil {
+						errs = append(errs, fmt.Errorf("%s: %w", c.DeviceID(), err))
+						return
+					}
+					output.Devices = append(output.Devices, c.DeviceID())
+				}()
+			}
+			wg.Wait()
+
+			return nil, output, errors.Join(errs...)
+		})
+
+	gomcp.AddTool(server, &gomcp.Tool{Name: "list_devices", Description: "List the devices of the agent with their tools"},
+		func(ctx context.Context, req *gomcp.CallToolRequest, _ struct{}) (*gomcp.CallToolResult, listDevicesOutput, error) {
+			devices, err := h.agentDevices(agentID)
+			return nil, listDevicesOutput{Devices: devices}, err
+		})
+
+	gomcp.AddTool(server, &gomcp.Tool{Name: "get_chat_history", Description: "Read the latest messages between the agent and its users, oldest first"},
+		func(ctx context.Context, req *gomcp.CallToolRequest, input historyInput) (*gomcp.CallToolResult, historyOutput, error) {
+			limit := input.Limit
+			if limit <= 0 {
+				limit = defaultHistoryLimit
+			}
+			limit = min(limit, maxHistoryLimit)
+
+			messages, err := h.services.History.Recent(agentID, limit)
+			return nil, historyOutput{Messages: messages}, err
+		})
+
+	gomcp.AddTool(server, &gomcp.Tool{Name: "call_device_tool", Description: "Call a tool of a connected device, list_devices tells which ones exist"},
+		func(ctx context.Context, req *gomcp.CallToolRequest, input callDeviceToolInput) (*gomcp.CallToolResult, any, error) {
+			result, err := h.callDeviceTool(ctx, agentID, input.Device, input.Name, input.Arguments)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			res, err := toolResult(result)
+			return res, nil, err
+		})
+
+	for _, c := range h.clients.ByAgent(agentID) {
+		for _, tool := range c.DeviceTools() {
+			proxy := *tool
+			proxy.Name = c.DeviceID() + "_" + tool.Name
+			// results are passed on as they come, the declared output schema is the device's business
+			proxy.OutputSchema = nil
+			server.AddTool(&proxy, func(ctx context.Context, req *gomcp.CallToolRequest) (*gomcp.CallToolResult, error) {
+				var arguments map[string]any
+				if len(req.Params.Arguments) > 0 {
+					if err := json.Unmarshal(req.Params.Arguments, &arguments); err != nil {
+						return nil, err
+					}
+				}
+
+				result, err := h.callDeviceTool(ctx, agentID, c.DeviceID(), tool.Name, arguments)
+				if err != nil {
+					return toolError(err), nil
+				}
+
+				return toolResult(result)
+			})
+		}
+	}
+
+	return server
+}
+
+// agentClients returns the connected clients of the agent, or of one of its devices
+func (h *Hub) agentClients(agentID, deviceID string) ([]*ws.Client, error) {
+	if deviceID == "" {
+		return h.clients.ByAgent(agentID), nil
+	}
+
+	c, ok := h.clients.Get(deviceID)
+	if !ok || c.AgentID() != agentID {
+		return nil, fmt.Errorf("device %s is not connected", deviceID)
+	}
+
+	return []*ws.Client{c}, nil
+}
+
+func (h *Hub) agentDevices(agentID string) ([]deviceInfo, error) {
+	records, err := h.FindRecordsByFilter("ai_device", "agent = {:agent}", "mac_address", 0, 0, map[string]any{"agent": agentID})
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]deviceInfo, len(records))
+	for i, record := range records {
+		devices[i] = deviceInfo{ID: record.Id, MacAddress: record.GetString("mac_address"), Board: record.GetString("board")}
+		if c, ok := h.clients.Get(record.Id); ok {
+			devices[i].Online = true
+			for _, tool := range c.DeviceTools() {
+				devices[i].Tools = append(devices[i].Tools, tool.Name)
+			}
+		}
+	}
+
+	return devices, nil
+}
+
+func (h *Hub) callDeviceTool(ctx context.Context, agentID, deviceID, name string, arguments map[string]any) (any, error) {
+	if deviceID == "" {
+		return nil, errors.New("device is required")
+	}
+
+	clients, err := h.agentClients(agentID, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return clients[0].CallTool(ctx, name, arguments)
+}
+
+func toolResult(result any) (*gomcp.CallToolResult, error) {
+	if text, ok := result.(string); ok {
+		return &gomcp.CallToolResult{Content: []gomcp.Content{&gomcp.TextContent{Text: text}}}, nil
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &gomcp.CallToolResult{Content: []gomcp.Content{&gomcp.TextContent{Text: string(data)}}}
+	// structured content has to be an object
+	if object, ok := result.(map[string]any); ok {
+		res.StructuredContent = object
+	}
+
+	return res, nil
+}
+
+func toolError(err error) *gomcp.CallToolResult {
+	return &gomcp.CallToolResult{
+		Content: []gomcp.Content{&gomcp.TextContent{Text: err.Error()}},
+		IsError: true,
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"net/http"
 	"os"
 
+	"github.com/phamviet/xiaozhi-hub/internal/hub/mqtt"
 	"github.com/phamviet/xiaozhi-hub/internal/hub/services"
+	"github.com/phamviet/xiaozhi-hub/internal/hub/ws"
 	"github.com/pocketbase/pocketbase"
 	"github.com/pocketbase/pocketbase/core"
 )
@@ -15,12 +17,17 @@ type Hub struct {
 	appURL   string
 	plugins  []Plugin
 	services *services.ServiceContainer
+	gateway  *mqtt.Gateway
+	// mqttEndpoint is the endpoint the gateway was started for, empty when it is not running
+	mqttEndpoint string
+	clients      *ws.Registry
 }
 
 func NewHub(app core.App, plugins []Plugin) *Hub {
 	hub := &Hub{
 		plugins:  plugins,
 		services: services.NewServiceContainer(app),
+		clients:  ws.NewRegistry(),
 	}
 	hub.App = app
 	hub.appURL, _ = os.LookupEnv("APP_URL")
@@ -53,10 +60,16 @@ func (h *Hub) StartHub() error {
 			return err
 		}
 
+		h.startMqttGateway(e)
+		h.startReminders(e)
+
 		return e.Next()
 	})
 
 	h.App.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+		if h.gateway != nil {
+			_ = h.gateway.Close()
+		}
 		return e.Next()
 	})
 
@@ -70,6 +83,16 @@ func (h *Hub) StartHub() error {
 	return nil
 }
 
+// Clients returns the live device clients, for plugins that push to devices
+func (h *Hub) Clients() *ws.Registry {
+	return h.clients
+}
+
+// MqttEndpoint returns the public endpoint of the running MQTT + UDP gateway, empty when it did not start
+func (h *Hub) MqttEndpoint() string {
+	return h.mqttEndpoint
+}
+
 // preStart sets up initial configuration (collections, settings, etc.)
 func (h *Hub) preStart(e *core.ServeEvent) error {
 	if err := h.registerRoutes(e); err != nil {
@@ -117,5 +140,8 @@ func (h *Hub) registerRoutes(se *core.ServeEvent) error {
 
 	apiNoAuth.GET("/v1", h.handleAgentConnect)
 
+	h.registerPushRoutes(se)
+	h.registerAgentMCPRoutes(se)
+
 	return nil
 }
@@ -0,0 +1,38 @@
+package mqtt
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	// clientIDGroup prefixes every device client id, the format follows the xiaozhi MQTT gateway
+	clientIDGroup = "GID_xiaozhi"
+	clientIDSep   = "@@@"
+
+	// PublishTopic is where devices send their JSON messages
+	PublishTopic = "device-server"
+)
+
+var ErrInvalidClientID = errors.New("invalid mqtt client id")
+
+// ClientID is the MQTT client id handed to a device by the OTA endpoint,
+// it carries the MAC address and the client uuid the password token is signed for
+func ClientID(macAddress, clientUUID string) string {
+	return clientIDGroup + clientIDSep + strings.ReplaceAll(macAddress, ":", "_") + clientIDSep + clientUUID
+}
+
+// ParseClientID returns the MAC address and client uuid of a ClientID
+func ParseClientID(clientID string) (macAddress, clientUUID string, err error) {
+	parts := strings.Split(clientID, clientIDSep)
+	if len(parts) != 3 || parts[0] != clientIDGroup || parts[1] == "" || parts[2] == "" {
+		return "", "", ErrInvalidClientID
+	}
+
+	return strings.ReplaceAll(parts[1], "_", ":"), parts[2], nil
+}
+
+// SubscribeTopic is where the hub sends JSON messages to one device
+func SubscribeTopic(macAddress string) string {
+	return "devices/p2p/" + strings.ReplaceAll(macAddress, ":", "_")
+}
@@ -0,0 +1,387 @@
+// Package mqtt serves xiaozhi devices using the MQTT + UDP protocol: JSON messages go through an
+// embedded MQTT broker and Opus audio through AES-CTR encrypted UDP packets. Every audio channel
+// the device opens becomes a regular ws.Client, so the voice pipeline does not know the transport.
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/phamviet/xiaozhi-hub/internal/hub/services"
+	"github.com/phamviet/xiaozhi-hub/internal/hub/ws"
+	"github.com/phamviet/xiaozhi-hub/internal/hub/ws/types"
+)
+
+// sessionIdleTimeout closes audio channels that saw no traffic, like the WebSocket open deadline
+const sessionIdleTimeout = 300 * time.Second
+
+type Config struct {
+	// ListenAddr is the MQTT broker address, e.g. ":1883"
+	ListenAddr string
+	// UDPListenAddr is the audio address, e.g. ":8884"
+	UDPListenAddr string
+	// UDPPublicAddr is the host:port devices send audio to, the host is resolved to an IPv4 address
+	UDPPublicAddr string
+}
+
+type Gateway struct {
+	cfg      Config
+	services *services.ServiceContainer
+	clients  *ws.Registry
+	logger   *slog.Logger
+
+	broker *mochi.Server
+	udp    *net.UDPConn
+	public *net.UDPAddr
+
+	mu          sync.Mutex
+	sessions    map[uint32]*session // by ssrc
+	devices     map[string]*session // by MQTT client id, one audio channel per device
+	connections map[*mochi.Client]*connection
+	done        chan struct{}
+}
+
+// connection is the presence record of a device connected to the broker
+type connection struct {
+	deviceID      string
+	id            string
+	clientVersion int
+}
+
+func NewGateway(cfg Config, services *services.ServiceContainer, clients *ws.Registry, logger *slog.Logger) *Gateway {
+	return &Gateway{
+		cfg:      cfg,
+		services: services,
+		clients:  clients,
+		logger:   logger,
+		sessions: make(map[uint32]*session),
+		devices:  make(map[string]*session),
+		done:     make(chan struct{}),
+
+		connections: make(map[*mochi.Client]*connection),
+	}
+}
+
+// Start opens the broker and the UDP listener, it does not block
+func (g *Gateway) Start() error {
+	public, err := net.ResolveUDPAddr("udp4", g.cfg.UDPPublicAddr)
+	if err != nil || public.IP == nil || public.IP.IsUnspecified() {
+		return fmt.Errorf("invalid udp public address %q: %w", g.cfg.UDPPublicAddr, errors.Join(err, errors.New("a reachable host is required")))
+	}
+	g.public = public
+
+	listen, err := net.ResolveUDPAddr("udp", g.cfg.UDPListenAddr)
+	if err != nil {
+		return fmt.Errorf("invalid udp listen address: %w", err)
+	}
+
+	if g.udp, err = net.ListenUDP("udp", listen); err != nil {
+		return fmt.Errorf("failed to listen on udp: %w", err)
+	}
+
+	g.broker = mochi.New(&mochi.Options{InlineClient: true, Logger: g.logger})
+	if err := g.broker.AddHook(&hook{gateway: g}, nil); err != nil {
+		_ = g.udp.Close()
+		return fmt.Errorf("failed to add mqtt hook: %w", err)
+	}
+
+	if err := g.broker.AddListener(listeners.NewTCP(listeners.Config{ID: "devices", Address: g.cfg.ListenAddr})); err != nil {
+		_ = g.udp.Close()
+		return fmt.Errorf("failed to listen on mqtt: %w", err)
+	}
+
+	if err := g.broker.Serve(); err != nil {
+		_ = g.udp.Close()
+		return fmt.Errorf("failed to start mqtt broker: %w", err)
+	}
+
+	go g.readUDP()
+	go g.reapSessions()
+
+	g.logger.Info("mqtt gateway started", "mqtt", g.cfg.ListenAddr, "udp", g.cfg.UDPListenAddr, "public", g.public.String())
+
+	return nil
+}
+
+func (g *Gateway) Close() error {
+	close(g.done)
+
+	g.mu.Lock()
+	open := make([]*session, 0, len(g.sessions))
+	for _, s := range g.sessions {
+		open = append(open, s)
+	}
+	g.mu.Unlock()
+
+	for _, s := range open {
+		g.closeSession(s, false)
+	}
+
+	return errors.Join(g.broker.Close(), g.udp.Close())
+}
+
+// handleMessage routes a JSON message published by a device
+func (g *Gateway) handleMessage(cl *mochi.Client, payload []byte) {
+	mqttID := cl.ID
+
+	var base types.BaseMessage
+	if err := json.Unmarshal(payload, &base); err != nil {
+		g.logger.Warn("invalid mqtt message", "client", mqttID, "error", err)
+		return
+	}
+
+	switch base.Type {
+	case types.MessageTypeHello:
+		g.openSession(cl, payload)
+	case types.MessageTypeGoodbye:
+		if s := g.deviceSession(mqttID); s != nil && (base.SessionID == "" || base.SessionID == s.client.SessionID()) {
+			g.closeSession(s, false)
+		}
+	default:
+		s := g.deviceSession(mqttID)
+		if s == nil {
+			g.logger.Debug("mqtt message without an audio channel", "client", mqttID, "type", base.Type)
+			return
+		}
+
+		s.touch()
+		s.client.OnTextMessage(payload)
+	}
+}
+
+// openSession starts a voice session for the hello of a device, replacing its previous audio channel
+func (g *Gateway) openSession(cl *mochi.Client, hello []byte) {
+	mqttID := cl.ID
+	macAddress, _, err := ParseClientID(mqttID)
+	if err != nil {
+		return
+	}
+
+	if s := g.deviceSession(mqttID); s != nil {
+		g.closeSession(s, false)
+	}
+
+	deviceID, err := g.services.Device.ValidateDevice(macAddress)
+	if err != nil {
+		g.logger.Warn("device validation failed", "error", err, "mac", macAddress)
+		return
+	}
+
+	sessionID, err := g.services.Session.CreateSession(deviceID)
+	if err != nil {
+		g.logger.Error("failed to create session", "error", err)
+		return
+	}
+
+	s := &session{
+		gateway:  g,
+		mqttID:   mqttID,
+		topic:    SubscribeTopic(macAddress),
+		started:  time.Now(),
+		deadline: time.Now().Add(sessionIdleTimeout),
+		audio:    make(chan []byte, audioQueueSize),
+		done:     make(chan struct{}),
+	}
+
+	logger := g.logger.With("device", deviceID).With("sessionId", sessionID).With("transport", "udp")
+	if s.client, err = ws.NewClient(s, deviceID, sessionID, g.services, logger); err != nil {
+		logger.Error("failed to create client", "error", err)
+		return
+	}
+
+	s.audioDone.Add(1)
+	go s.processAudio()
+
+	if err := g.register(s); err != nil {
+		logger.Error("failed to open udp channel", "error", err)
+		s.stopAudio()
+		s.client.Close()
+		return
+	}
+
+	g.clients.Register(s.client)
+
+	// the client answers with the server hello, WriteHello adds the UDP keys
+	s.client.OnTextMessage(hello)
+
+	g.mu.Lock()
+	if c := g.connections[cl]; c != nil {
+		c.clientVersion = s.client.ProtocolVersion()
+	}
+	g.mu.Unlock()
+}
+
+// deviceConnected marks a bound device online while it is connected to the broker
+func (g *Gateway) deviceConnected(cl *mochi.Client) {
+	macAddress, _, err := ParseClientID(cl.ID)
+	if err != nil {
+		return
+	}
+
+	deviceID, err := g.services.Device.ValidateDevice(macAddress)
+	if err != nil {
+		return
+	}
+
+	ip, _, _ := net.SplitHostPort(cl.Net.Remote)
+	id, err := g.services.Device.Connected(deviceID, services.ConnectionInfo{Transport: services.TransportMqtt, IP: ip})
+	if err != nil {
+		g.logger.Error("failed to record device connection", "error", err, "device", deviceID)
+		return
+	}
+
+	g.mu.Lock()
+	g.connections[cl] = &connection{deviceID: deviceID, id: id}
+	g.mu.Unlock()
+}
+
+// deviceDisconnected closes the connection record, the device is reported offline
+// unless it reconnects within the grace period
+func (g *Gateway) deviceDisconnected(cl *mochi.Client, cause error) {
+	g.mu.Lock()
+	c := g.connections[cl]
+	delete(g.connections, cl)
+	g.mu.Unlock()
+	if c == nil {
+		return
+	}
+
+	reason := "closed"
+	if cause != nil {
+		reason = cause.Error()
+	}
+	if err := g.services.Device.Disconnected(c.id, c.clientVersion, reason); err != nil {
+		g.logger.Error("failed to record disconnection", "error", err, "device", c.deviceID)
+	}
+
+	time.AfterFunc(ws.ReconnectGrace, func() {
+		if err := g.services.Device.SetOffline(c.deviceID, c.id); err != nil {
+			g.logger.Error("failed to record device offline", "error", err, "device", c.deviceID)
+		}
+	})
+}
+
+// register assigns an unused ssrc and the session keys
+func (g *Gateway) register(s *session) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for {
+		ssrc := randomUint32()
+		if _, taken := g.sessions[ssrc]; taken || ssrc == 0 {
+			continue
+		}
+
+		key, err := newPacketKey(ssrc)
+		if err != nil {
+			return err
+		}
+
+		s.ssrc, s.key = ssrc, key
+		g.sessions[ssrc] = s
+		g.devices[s.mqttID] = s
+
+		return nil
+	}
+}
+
+func (g *Gateway) deviceSession(mqttID string) *session {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.devices[mqttID]
+}
+
+// closeSession ends the client once, notify asks the device to close its audio channel
+func (g *Gateway) closeSession(s *session, notify bool) {
+	s.closeOnce.Do(func() {
+		g.mu.Lock()
+		delete(g.sessions, s.ssrc)
+		if g.devices[s.mqttID] == s {
+			delete(g.devices, s.mqttID)
+		}
+		g.mu.Unlock()
+
+		if notify {
+			s.sendGoodbye()
+		}
+
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+
+		s.stopAudio()
+		s.client.Close()
+	})
+}
+
+// readUDP hands decrypted audio to the session its ssrc belongs to
+func (g *Gateway) readUDP() {
+	buf := make([]byte, maxUDPPacketSize)
+	for {
+		n, addr, err := g.udp.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			g.logger.Debug("udp read failed", "error", err)
+			continue
+		}
+
+		ssrc, err := packetSSRC(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		g.mu.Lock()
+		s := g.sessions[ssrc]
+		g.mu.Unlock()
+		if s == nil {
+			continue
+		}
+
+		payload, sequence, err := s.key.open(buf[:n])
+		if err != nil {
+			g.logger.Debug("dropping udp packet", "error", err, "from", addr.String())
+			continue
+		}
+
+		if s.receive(addr, sequence) {
+			s.enqueue(payload)
+		}
+	}
+}
+
+// reapSessions closes audio channels the device stopped using without a goodbye
+func (g *Gateway) reapSessions() {
+	ticker := time.NewTicker(ws.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.done:
+			return
+		case now := <-ticker.C:
+			g.mu.Lock()
+			var expired []*session
+			for _, s := range g.sessions {
+				if s.expired(now) {
+					expired = append(expired, s)
+				}
+			}
+			g.mu.Unlock()
+
+			for _, s := range expired {
+				s.client.Logger().Info("closing idle udp session")
+				g.closeSession(s, true)
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package mqtt
+
+import (
+	"bytes"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// hook authenticates devices with their OTA token and routes what they publish to the gateway
+type hook struct {
+	mochi.HookBase
+	gateway *Gateway
+}
+
+func (h *hook) ID() string {
+	return "xiaozhi-devices"
+}
+
+func (h *hook) Provides(b byte) bool {
+	return bytes.Contains([]byte{
+		mochi.OnConnectAuthenticate,
+		mochi.OnACLCheck,
+		mochi.OnSessionEstablished,
+		mochi.OnPublish,
+		mochi.OnDisconnect,
+	}, []byte{b})
+}
+
+// OnConnectAuthenticate expects the client id, username and password returned by /xiaozhi/ota
+func (h *hook) OnConnectAuthenticate(cl *mochi.Client, pk packets.Packet) bool {
+	macAddress, clientUUID, err := ParseClientID(cl.ID)
+	if err != nil {
+		h.gateway.logger.Warn("mqtt client rejected", "error", err, "client", cl.ID)
+		return false
+	}
+
+	if string(pk.Connect.Username) != macAddress {
+		h.gateway.logger.Warn("mqtt client rejected", "error", "username does not match client id", "client", cl.ID)
+		return false
+	}
+
+	if err := h.gateway.services.Auth.VerifyDeviceToken(string(pk.Connect.Password), clientUUID, macAddress); err != nil {
+		h.gateway.logger.Warn("device token rejected", "error", err, "mac", macAddress, "clientId", clientUUID)
+		return false
+	}
+
+	return true
+}
+
+// OnACLCheck limits a device to the shared publish topic and its own subscribe topic
+func (h *hook) OnACLCheck(cl *mochi.Client, topic string, write bool) bool {
+	macAddress, _, err := ParseClientID(cl.ID)
+	if err != nil {
+		return false
+	}
+
+	if write {
+		return topic == PublishTopic
+	}
+
+	return topic == SubscribeTopic(macAddress)
+}
+
+// OnPublish hands device messages to the gateway instead of other subscribers
+func (h *hook) OnPublish(cl *mochi.Client, pk packets.Packet) (packets.Packet, error) {
+	if cl.Net.Inline || pk.TopicName != PublishTopic {
+		return pk, nil
+	}
+
+	h.gateway.handleMessage(cl, pk.Payload)
+
+	return pk, packets.CodeSuccessIgnore
+}
+
+// OnSessionEstablished records the device online for as long as it stays connected
+func (h *hook) OnSessionEstablished(cl *mochi.Client, pk packets.Packet) {
+	h.gateway.deviceConnected(cl)
+}
+
+// OnDisconnect ends the audio channel of a device that left the broker
+func (h *hook) OnDisconnect(cl *mochi.Client, err error, expire bool) {
+	if s := h.gateway.deviceSession(cl.ID); s != nil {
+		h.gateway.closeSession(s, false)
+	}
+
+	h.gateway.deviceDisconnected(cl, err)
+}
@@ -0,0 +1,94 @@
+package mqtt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+)
+
+// UDP audio packets are a 16 byte header followed by the AES-128-CTR encrypted Opus frame,
+// the header doubles as the CTR IV:
+//
+//	[0] type 0x01, [1] flags, [2:4] payload size, [4:8] ssrc, [8:12] timestamp ms, [12:16] sequence
+const (
+	headerSize       = 16
+	packetTypeAudio  = 0x01
+	maxUDPPacketSize = 1500
+)
+
+var (
+	ErrShortPacket   = errors.New("udp packet too short")
+	ErrPacketType    = errors.New("unknown udp packet type")
+	ErrPayloadLength = errors.New("udp payload size does not match header")
+)
+
+// packetKey is the per session encryption state handed to the device in the hello
+type packetKey struct {
+	block cipher.Block
+	key   []byte
+	nonce [headerSize]byte
+}
+
+// newPacketKey creates a random AES key and a header template for the given ssrc
+func newPacketKey(ssrc uint32) (*packetKey, error) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &packetKey{block: block, key: key}
+	k.nonce[0] = packetTypeAudio
+	binary.BigEndian.PutUint32(k.nonce[4:8], ssrc)
+
+	return k, nil
+}
+
+// packetSSRC identifies the session of an incoming packet before it is decrypted
+func packetSSRC(packet []byte) (uint32, error) {
+	if len(packet) < headerSize {
+		return 0, ErrShortPacket
+	}
+
+	return binary.BigEndian.Uint32(packet[4:8]), nil
+}
+
+// seal encrypts payload into a new packet
+func (k *packetKey) seal(payload []byte, timestamp, sequence uint32) []byte {
+	packet := make([]byte, headerSize+len(payload))
+	copy(packet, k.nonce[:])
+	binary.BigEndian.PutUint16(packet[2:4], uint16(len(payload)))
+	binary.BigEndian.PutUint32(packet[8:12], timestamp)
+	binary.BigEndian.PutUint32(packet[12:16], sequence)
+
+	cipher.NewCTR(k.block, packet[:headerSize]).XORKeyStream(packet[headerSize:], payload)
+
+	return packet
+}
+
+// open decrypts a packet, it returns the payload and the sender's sequence number
+func (k *packetKey) open(packet []byte) ([]byte, uint32, error) {
+	if len(packet) < headerSize {
+		return nil, 0, ErrShortPacket
+	}
+
+	if packet[0] != packetTypeAudio {
+		return nil, 0, ErrPacketType
+	}
+
+	size := int(binary.BigEndian.Uint16(packet[2:4]))
+	if size != len(packet)-headerSize {
+		return nil, 0, ErrPayloadLength
+	}
+
+	payload := make([]byte, size)
+	cipher.NewCTR(k.block, packet[:headerSize]).XORKeyStream(payload, packet[headerSize:])
+
+	return payload, binary.BigEndian.Uint32(packet[12:16]), nil
+}
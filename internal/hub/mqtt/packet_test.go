@@ -0,0 +1,70 @@
+package mqtt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPacketRoundTrip(t *testing.T) {
+	key, err := newPacketKey(0x01020304)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte("opus frame")
+	packet := key.seal(payload, 60, 7)
+	if bytes.Contains(packet, payload) {
+		t.Fatal("payload is not encrypted")
+	}
+
+	ssrc, err := packetSSRC(packet)
+	if err != nil || ssrc != 0x01020304 {
+		t.Fatalf("ssrc = %x, %v", ssrc, err)
+	}
+
+	got, sequence, err := key.open(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) || sequence != 7 {
+		t.Fatalf("open = %q, %d", got, sequence)
+	}
+}
+
+func TestPacketOpenErrors(t *testing.T) {
+	key, _ := newPacketKey(1)
+	packet := key.seal([]byte("frame"), 0, 1)
+
+	tests := map[string]struct {
+		packet []byte
+		want   error
+	}{
+		"short":     {packet[:10], ErrShortPacket},
+		"truncated": {packet[:len(packet)-1], ErrPayloadLength},
+		"type":      {append([]byte{0x02}, packet[1:]...), ErrPacketType},
+	}
+
+	for name, tt := range tests {
+		if _, _, err := key.open(tt.packet); err != tt.want {
+			t.Errorf("%s: err = %v, want %v", name, err, tt.want)
+		}
+	}
+}
+
+func TestClientID(t *testing.T) {
+	id := ClientID("AA:BB:CC:00:11:22", "client-uuid")
+	if id != "GID_xiaozhi@@@AA_BB_CC_00_11_22@@@client-uuid" {
+		t.Fatalf("ClientID = %q", id)
+	}
+
+	mac, uuid, err := ParseClientID(id)
+	if err != nil || mac != "AA:BB:CC:00:11:22" || uuid != "client-uuid" {
+		t.Fatalf("ParseClientID = %q, %q, %v", mac, uuid, err)
+	}
+
+	for _, invalid := range []string{"", "device", "GID_other@@@AA@@@x", "GID_xiaozhi@@@@@@x"} {
+		if _, _, err := ParseClientID(invalid); err == nil {
+			t.Errorf("ParseClientID(%q) accepted", invalid)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package mqtt
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/lxzan/gws"
+	"github.com/phamviet/xiaozhi-hub/internal/hub/ws"
+	"github.com/phamviet/xiaozhi-hub/internal/hub/ws/types"
+)
+
+// session is one audio channel of a device, the ws.Conn of its client
+type session struct {
+	gateway *Gateway
+	client  *ws.Client
+	mqttID  string
+	topic   string
+	ssrc    uint32
+	key     *packetKey
+	started time.Time
+
+	mu        sync.Mutex
+	remote    *net.UDPAddr // learned from the device's packets, NAT may change it
+	sequence  uint32
+	remoteSeq uint32
+	deadline  time.Time
+	closed    bool
+	closeOnce sync.Once
+
+	// audio is decoded by the session's own goroutine, the UDP reader is shared by every device
+	audio     chan []byte
+	done      chan struct{}
+	audioDone sync.WaitGroup
+}
+
+// audioQueueSize holds about 4 seconds of 60ms frames
+const audioQueueSize = 64
+
+var (
+	_ ws.Conn        = (*session)(nil)
+	_ ws.HelloWriter = (*session)(nil)
+)
+
+// SetDeadline only moves the idle deadline forward, traffic in both directions keeps the channel open
+func (s *session) SetDeadline(t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t.After(s.deadline) {
+		s.deadline = t
+	}
+
+	return nil
+}
+
+// WriteMessage publishes JSON on the device topic and sends audio over UDP
+func (s *session) WriteMessage(opcode gws.Opcode, payload []byte) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return gws.ErrConnClosed
+	}
+
+	if opcode == gws.OpcodeText {
+		s.mu.Unlock()
+		return s.gateway.broker.Publish(s.topic, payload, false, 0)
+	}
+
+	if s.remote == nil {
+		// the device sends audio first, until then there is no address to reply to
+		s.mu.Unlock()
+		return nil
+	}
+
+	s.sequence++
+	packet := s.key.seal(payload, uint32(time.Since(s.started).Milliseconds()), s.sequence)
+	remote := s.remote
+	s.mu.Unlock()
+
+	_, err := s.gateway.udp.WriteToUDP(packet, remote)
+	return err
+}
+
+// WriteClose sends a goodbye, the client is closed asynchronously as it may be the caller
+func (s *session) WriteClose(code uint16, reason []byte) error {
+	go s.gateway.closeSession(s, true)
+	return nil
+}
+
+// WriteHello switches the server hello to the UDP transport
+func (s *session) WriteHello(msg *types.HelloMessage) {
+	msg.Transport = "udp"
+	msg.UDP = &types.UDPParams{
+		Server: s.gateway.public.IP.String(),
+		Port:   s.gateway.public.Port,
+		Key:    hex.EncodeToString(s.key.key),
+		Nonce:  hex.EncodeToString(s.key.nonce[:]),
+	}
+}
+
+func (s *session) sendGoodbye() {
+	data, err := json.Marshal(types.BaseMessage{Type: types.MessageTypeGoodbye, SessionID: s.client.SessionID()})
+	if err != nil {
+		return
+	}
+
+	if err := s.gateway.broker.Publish(s.topic, data, false, 0); err != nil {
+		s.client.Logger().Debug("failed to send goodbye", "error", err)
+	}
+}
+
+// enqueue hands a packet to the session goroutine, it is dropped when the client is too far behind
+func (s *session) enqueue(payload []byte) {
+	select {
+	case s.audio <- payload:
+	default:
+		s.client.Logger().Debug("audio queue full, dropping packet")
+	}
+}
+
+func (s *session) processAudio() {
+	defer s.audioDone.Done()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case payload := <-s.audio:
+			s.client.OnBinaryMessage(payload)
+		}
+	}
+}
+
+// stopAudio waits for the session goroutine, the client must not be closed while it decodes
+func (s *session) stopAudio() {
+	close(s.done)
+	s.audioDone.Wait()
+}
+
+// touch records activity from the device
+func (s *session) touch() {
+	_ = s.SetDeadline(time.Now().Add(sessionIdleTimeout))
+}
+
+// The packet header is not authenticated, anyone knowing the ssrc can forge one. These bound how far a
+// single packet may move the session so that a forged one can neither take the downlink nor lock the device out.
+const (
+	// addressChangeWindow is the sequence jump a packet from a new address may make, a NAT rebinding loses a few packets at most
+	addressChangeWindow = 32
+	// maxSequenceGap is the jump any packet may make, about the idle timeout of 60ms frames
+	maxSequenceGap = uint32(sessionIdleTimeout / (60 * time.Millisecond))
+)
+
+// receive records the sender of a packet, stale, replayed or implausibly far ahead packets are rejected
+func (s *session) receive(addr *net.UDPAddr, sequence uint32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed || sequence <= s.remoteSeq {
+		return false
+	}
+
+	gap := sequence - s.remoteSeq
+	if gap > maxSequenceGap {
+		return false
+	}
+
+	// the first packet sets the address, later ones only move it when they follow the device's sequence
+	if s.remote != nil && s.remote.AddrPort() != addr.AddrPort() && gap > addressChangeWindow {
+		return false
+	}
+
+	s.remoteSeq = sequence
+	s.remote = addr
+	if deadline := time.Now().Add(sessionIdleTimeout); deadline.After(s.deadline) {
+		s.deadline = deadline
+	}
+
+	return true
+}
+
+func (s *session) expired(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return now.After(s.deadline)
+}
+
+func randomUint32() uint32 {
+	var b [4]byte
+	_, _ = rand.Read(b[:])
+	return binary.BigEndian.Uint32(b[:])
+}
@@ -0,0 +1,56 @@
+package mqtt
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSessionReceive(t *testing.T) {
+	device := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 10), Port: 40000}
+	attacker := &net.UDPAddr{IP: net.IPv4(198, 51, 100, 7), Port: 50000}
+	rebound := &net.UDPAddr{IP: net.IPv4(192, 0, 2, 10), Port: 40001}
+
+	s := &session{}
+	for seq := uint32(1); seq <= 10; seq++ {
+		if !s.receive(device, seq) {
+			t.Fatalf("packet %d of the device rejected", seq)
+		}
+	}
+
+	t.Run("hijack", func(t *testing.T) {
+		if s.receive(attacker, 0xFFFFFFFF) {
+			t.Fatal("forged packet far ahead accepted")
+		}
+		if s.receive(attacker, 10+addressChangeWindow+1) {
+			t.Fatal("packet from a new address beyond the window accepted")
+		}
+		if s.remote != device {
+			t.Fatalf("remote moved to %s", s.remote)
+		}
+	})
+
+	t.Run("lock-out", func(t *testing.T) {
+		// the header is not authenticated, so a forgery may also carry the device address
+		if s.receive(device, 0xFFFFFFFF) {
+			t.Fatal("packet far ahead accepted")
+		}
+		if !s.receive(device, 11) {
+			t.Fatal("next packet of the device rejected")
+		}
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		if s.receive(device, 11) || s.receive(device, 5) {
+			t.Fatal("stale packet accepted")
+		}
+	})
+
+	t.Run("nat rebinding", func(t *testing.T) {
+		if !s.receive(rebound, 14) {
+			t.Fatal("packet from the rebound address rejected")
+		}
+		if s.remote != rebound {
+			t.Fatalf("remote = %s, want %s", s.remote, rebound)
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package hub
+
+import (
+	"net"
+
+	"github.com/phamviet/xiaozhi-hub/internal/hub/mqtt"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	defaultMqttListenAddr = ":1883"
+	defaultUDPListenAddr  = ":8884"
+)
+
+// startMqttGateway serves MQTT + UDP devices when `mqtt.endpoint` is set, sys param changes need a restart.
+// A broken configuration is only logged so that the admin UI stays reachable to fix it.
+func (h *Hub) startMqttGateway(e *core.ServeEvent) {
+	param := h.services.Agent.GetSysParam
+	endpoint := param("mqtt.endpoint")
+	if endpoint == "" {
+		return
+	}
+
+	cfg := mqtt.Config{
+		ListenAddr:    param("mqtt.listen_addr"),
+		UDPListenAddr: param("udp.listen_addr"),
+		UDPPublicAddr: param("udp.public_addr"),
+	}
+	if cfg.ListenAddr == "" {
+		cfg.ListenAddr = defaultMqttListenAddr
+	}
+	if cfg.UDPListenAddr == "" {
+		cfg.UDPListenAddr = defaultUDPListenAddr
+	}
+	if cfg.UDPPublicAddr == "" {
+		// devices reach the audio port on the same host as the broker
+		host, _, _ := net.SplitHostPort(endpoint)
+		_, port, _ := net.SplitHostPort(cfg.UDPListenAddr)
+		cfg.UDPPublicAddr = net.JoinHostPort(host, port)
+	}
+
+	gateway := mqtt.NewGateway(cfg, h.services, h.clients, e.App.Logger().With("component", "mqtt"))
+	if err := gateway.Start(); err != nil {
+		e.App.Logger().Error("failed to start mqtt gateway", "error", err)
+		return
+	}
+
+	h.gateway = gateway
+	h.mqttEndpoint = endpoint
+}
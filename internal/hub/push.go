@@ -0,0 +1,143 @@
+package hub
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phamviet/xiaozhi-hub/internal/hub/ws"
+	"github.com/pocketbase/pocketbase/apis"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// pushToolTimeout bounds a device MCP tool call made through the push API
+const pushToolTimeout = 30 * time.Second
+
+// pushTarget is one device or every connected device of an agent
+type pushTarget struct {
+	Device string `json:"device"`
+	Agent  string `json:"agent"`
+}
+
+type pushResult struct {
+	Device string `json:"device"`
+	OK     bool   `json:"ok"`
+	Result any    `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// registerPushRoutes lets device owners reach connected devices from outside their connection
+func (h *Hub) registerPushRoutes(se *core.ServeEvent) {
+	push := se.Router.Group("/api/push")
+	push.Bind(apis.RequireAuth())
+
+	// announcements play asynchronously, the result only tells which devices received one
+	push.POST("/announce", func(e *core.RequestEvent) error {
+		var body struct {
+			pushTarget
+			Text string `json:"text"`
+		}
+		if err := e.BindBody(&body); err != nil || strings.TrimSpace(body.Text) == "" {
+			return e.BadRequestError("text is required", err)
+		}
+
+		return h.push(e, body.pushTarget, func(ctx context.Context, c *ws.Client) (any, error) {
+			go func() {
+				if err := c.Announce(context.Background(), body.Text); err != nil {
+					c.Logger().Warn("announcement failed", "error", err)
+				}
+			}()
+			return nil, nil
+		})
+	})
+
+	push.POST("/system", func(e *core.RequestEvent) error {
+		var body struct {
+			pushTarget
+			Command string `json:"command"`
+		}
+		if err := e.BindBody(&body); err != nil || body.Command == "" {
+			return e.BadRequestError("command is required", err)
+		}
+
+		return h.push(e, body.pushTarget, func(ctx context.Context, c *ws.Client) (any, error) {
+			return nil, c.SendSystemCommand(body.Command)
+		})
+	})
+
+	push.POST("/tool", func(e *core.RequestEvent) error {
+		var body struct {
+			pushTarget
+			Name      string         `json:"name"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		if err := e.BindBody(&body); err != nil || body.Name == "" {
+			return e.BadRequestError("name is required", err)
+		}
+
+		return h.push(e, body.pushTarget, func(ctx context.Context, c *ws.Client) (any, error) {
+			ctx, cancel := context.WithTimeout(ctx, pushToolTimeout)
+			defer cancel()
+			return c.CallTool(ctx, body.Name, body.Arguments)
+		})
+	})
+}
+
+// push runs fn for every target client concurrently and reports each device
+func (h *Hub) push(e *core.RequestEvent, target pushTarget, fn func(ctx context.Context, c *ws.Client) (any, error)) error {
+	clients, err := h.pushClients(e, target)
+	if err != nil {
+		return err
+	}
+
+	results := make([]pushResult, len(clients))
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			result, err := fn(e.Request.Context(), c)
+			results[i] = pushResult{Device: c.DeviceID(), OK: err == nil, Result: result}
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return e.JSON(http.StatusOK, map[string]any{"results": results})
+}
+
+// pushClients resolves the live clients of a target the caller owns
+func (h *Hub) pushClients(e *core.RequestEvent, target pushTarget) ([]*ws.Client, error) {
+	owns := func(record *core.Record) bool {
+		return e.HasSuperuserAuth() || record.GetString("user") == e.Auth.Id
+	}
+
+	switch {
+	case target.Device != "":
+		device, err := e.App.FindRecordById("ai_device", target.Device)
+		if err != nil || !owns(device) {
+			return nil, e.NotFoundError("device not found", err)
+		}
+
+		client, ok := h.clients.Get(device.Id)
+		if !ok {
+			return nil, e.Error(http.StatusConflict, "device is offline", nil)
+		}
+
+		return []*ws.Client{client}, nil
+	case target.Agent != "":
+		agent, err := e.App.FindRecordById("ai_agent", target.Agent)
+		if err != nil || !owns(agent) {
+			return nil, e.NotFoundError("agent not found", err)
+		}
+
+		return h.clients.ByAgent(agent.Id), nil
+	default:
+		return nil, e.BadRequestError("device or agent is required", nil)
+	}
+}
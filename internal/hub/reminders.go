@@ -0,0 +1,80 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/phamviet/xiaozhi-hub/internal/hub/services"
+	"github.com/phamviet/xiaozhi-hub/internal/hub/ws"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// reminderTimeout bounds the generation and playback of one reminder
+const reminderTimeout = 2 * time.Minute
+
+// startReminders fires due reminders every minute, devices that are offline get them when they connect
+func (h *Hub) startReminders(e *core.ServeEvent) {
+	// nothing sends yet, deliveries still claimed were left by a crash or restart
+	if released, err := h.services.Reminder.Release(); err != nil {
+		h.Logger().Error("failed to release claimed reminders", "error", err)
+	} else if released > 0 {
+		h.Logger().Info("released claimed reminders", "count", released)
+	}
+
+	h.clients.OnRegister(func(c *ws.Client) {
+		h.deliverPending(c, "")
+	})
+
+	e.App.Cron().MustAdd("reminders", "* * * * *", func() {
+		h.runReminders(time.Now())
+	})
+}
+
+func (h *Hub) runReminders(now time.Time) {
+	due, err := h.services.Reminder.Due(now)
+	if err != nil {
+		h.Logger().Error("failed to load due reminders", "error", err)
+		return
+	}
+
+	for _, r := range due {
+		// marked first, a failing reminder must not be queued again on every tick
+		if err := h.services.Reminder.MarkRun(r, now); err != nil {
+			h.Logger().Error("failed to mark reminder", "reminder", r.ID, "error", err)
+			continue
+		}
+
+		deliveries, err := h.services.Reminder.Queue(r)
+		if err != nil {
+			h.Logger().Error("failed to queue reminder", "reminder", r.ID, "error", err)
+		}
+
+		for _, d := range deliveries {
+			if c, ok := h.clients.Get(d.DeviceID); ok {
+				go h.deliverPending(c, d.ID)
+			}
+		}
+	}
+}
+
+// deliverPending plays the pending deliveries of the client's device, or only deliveryID when not empty
+func (h *Hub) deliverPending(c *ws.Client, deliveryID string) {
+	deliveries, err := h.services.Reminder.Claim(c.DeviceID(), deliveryID)
+	if err != nil {
+		c.Logger().Error("failed to claim reminders", "error", err)
+		return
+	}
+
+	for _, d := range deliveries {
+		ctx, cancel := context.WithTimeout(context.Background(), reminderTimeout)
+		err := c.Remind(ctx, d.Text, d.Mode == services.ReminderModeGenerate)
+		cancel()
+
+		// the device went away, it gets the reminder on its next connection
+		retry := errors.Is(err, ws.ErrClientNotReady) || errors.Is(err, context.Canceled)
+		if err := h.services.Reminder.Finish(d.ID, err, retry); err != nil {
+			c.Logger().Error("failed to record reminder delivery", "delivery", d.ID, "error", err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/phamviet/xiaozhi-hub/xiaozhi/store"
+	"github.com/phamviet/xiaozhi-hub/xiaozhi/types"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+type AgentService interface {
+	GetDeviceAgent(deviceID string) (*types.AIAgent, error)
+	GetModelConfig(id string, modelType string) (*types.ModelConfigJson, error)
+	GetSysParam(name string) string
+	GetMCPServers(agentID string) ([]MCPServer, error)
+}
+
+type agentService struct {
+	app   core.App
+	store func() *store.Manager
+}
+
+func NewAgentService(app core.App) AgentService {
+	return &agentService{
+		app: app,
+		// the store looks up collections, so it can only be created once the app is bootstrapped
+		store: sync.OnceValue(func() *store.Manager { return store.NewManager(app) }),
+	}
+}
+
+// GetDeviceAgent returns the agent bound to the device
+func (s *agentService) GetDeviceAgent(deviceID string) (*types.AIAgent, error) {
+	device, err := s.store().GetDeviceById(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if device.AgentId == "" {
+		return nil, errors.New("device has no agent")
+	}
+
+	return s.store().GetAgentByID(device.AgentId)
+}
+
+// GetModelConfig resolves the model config the same way /xiaozhi/config/agent-models does
+func (s *agentService) GetModelConfig(id string, modelType string) (*types.ModelConfigJson, error) {
+	return s.store().GetModelConfigJson(id, modelType)
+}
+
+// GetSysParam returns the value of a sys_params record, empty when it does not exist
+func (s *agentService) GetSysParam(name string) string {
+	return sysParam(s.app, name)
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/phamviet/xiaozhi-hub/internal/token"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/security"
+)
+
+// DefaultTokenMaxAge is used when `server.token_max_age` is not configured.
+// Devices only refresh their token on boot, so it has to outlive a normal uptime.
+const DefaultTokenMaxAge = 7 * 24 * time.Hour
+
+var (
+	ErrSecretNotConfigured = errors.New("server secret not configured")
+	ErrInvalidAgentToken   = errors.New("invalid agent token")
+)
+
+type AuthService interface {
+	VerifyDeviceToken(authorization, clientID, macAddress string) error
+	// RotateAgentToken issues the token of the agent MCP server, replacing the previous one. Only its hash is kept.
+	RotateAgentToken(agentID string) (string, error)
+	RevokeAgentToken(agentID string) error
+	VerifyAgentToken(agentID, agentToken string) error
+}
+
+type authService struct {
+	app core.App
+}
+
+func NewAuthService(app core.App) AuthService {
+	return &authService{app: app}
+}
+
+// VerifyDeviceToken checks the token issued by /xiaozhi/ota against the Client-Id and Device-Id headers
+func (s *authService) VerifyDeviceToken(authorization, clientID, macAddress string) error {
+	secret := sysParam(s.app, "server.secret")
+	if secret == "" {
+		return ErrSecretNotConfigured
+	}
+
+	return token.Verify(secret, authorization, clientID, macAddress, s.tokenMaxAge(), time.Now())
+}
+
+// tokenMaxAge reads `server.token_max_age` in seconds, 0 disables the age check
+func (s *authService) tokenMaxAge() time.Duration {
+	return secondsParam(s.app, "server.token_max_age", DefaultTokenMaxAge)
+}
+
+// agentTokenLength gives about 238 bits of entropy with the default alphabet
+const agentTokenLength = 40
+
+func (s *authService) RotateAgentToken(agentID string) (string, error) {
+	agentToken := security.RandomString(agentTokenLength)
+
+	return agentToken, s.setAgentTokenHash(agentID, hashAgentToken(agentToken))
+}
+
+func (s *authService) RevokeAgentToken(agentID string) error {
+	return s.setAgentTokenHash(agentID, "")
+}
+
+func (s *authService) VerifyAgentToken(agentID, agentToken string) error {
+	record, err := s.app.FindRecordById("ai_agent", agentID)
+	if err != nil {
+		return ErrInvalidAgentToken
+	}
+
+	hash := record.GetString("mcp_token")
+	if hash == "" || agentToken == "" || subtle.ConstantTimeCompare([]byte(hash), []byte(hashAgentToken(agentToken))) != 1 {
+		return ErrInvalidAgentToken
+	}
+
+	return nil
+}
+
+func (s *authService) setAgentTokenHash(agentID, hash string) error {
+	record, err := s.app.FindRecordById("ai_agent", agentID)
+	if err != nil {
+		return err
+	}
+
+	record.Set("mcp_token", hash)
+
+	return s.app.Save(record)
+}
+
+func hashAgentToken(agentToken string) string {
+	sum := sha256.Sum256([]byte(agentToken))
+	return hex.EncodeToString(sum[:])
+}
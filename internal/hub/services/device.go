@@ -2,12 +2,42 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
 )
 
+const (
+	TransportWebsocket = "websocket"
+	TransportMqtt      = "mqtt"
+)
+
+// ConnectionInfo describes a device connection when it opens
+type ConnectionInfo struct {
+	SessionID string
+	Transport string
+	IP        string
+}
+
 type DeviceService interface {
 	ValidateDevice(macAddress string) (string, error)
+	// Connected marks the device online and opens a connection record, its id is passed to Disconnected and SetOffline
+	Connected(deviceID string, info ConnectionInfo) (string, error)
+	// Disconnected closes a connection record, the device stays online until SetOffline
+	Disconnected(connectionID string, clientVersion int, reason string) error
+	// SetOffline marks the device offline unless it opened another connection since connectionID
+	SetOffline(deviceID, connectionID string) error
+	// SaveTools records the tool catalogue of the device MCP server
+	SaveTools(deviceID string, tools []DeviceTool) error
+}
+
+// DeviceTool describes a tool of the device MCP server
+type DeviceTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	InputSchema any    `json:"input_schema,omitempty"`
 }
 
 type deviceService struct {
@@ -35,3 +65,126 @@ func (s *deviceService) ValidateDevice(macAddress string) (string, error) {
 
 	return record.Id, nil
 }
+
+func (s *deviceService) Connected(deviceID string, info ConnectionInfo) (string, error) {
+	var connectionID string
+	err := s.app.RunInTransaction(func(txApp core.App) error {
+		device, err := txApp.FindRecordById("ai_device", deviceID)
+		if err != nil {
+			return err
+		}
+
+		now := types.NowDateTime()
+		device.Set("last_connected", now)
+		if err := txApp.Save(device); err != nil {
+			return err
+		}
+
+		connections, err := txApp.FindCollectionByNameOrId("ai_device_connection")
+		if err != nil {
+			return err
+		}
+
+		connection := core.NewRecord(connections)
+		connection.Set("device", deviceID)
+		connection.Set("session", info.SessionID)
+		connection.Set("transport", info.Transport)
+		connection.Set("ip", info.IP)
+		connection.Set("connected", now)
+		if err := txApp.Save(connection); err != nil {
+			return err
+		}
+		connectionID = connection.Id
+
+		presence, err := findPresence(txApp, deviceID)
+		if err != nil {
+			return err
+		}
+
+		presence.Set("online", true)
+		presence.Set("connection", connection.Id)
+		presence.Set("last_seen", now)
+
+		return txApp.Save(presence)
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to record device connection: %w", err)
+	}
+
+	return connectionID, nil
+}
+
+func (s *deviceService) Disconnected(connectionID string, clientVersion int, reason string) error {
+	connection, err := s.app.FindRecordById("ai_device_connection", connectionID)
+	if err != nil {
+		return fmt.Errorf("failed to find device connection: %w", err)
+	}
+
+	now := types.NowDateTime()
+	connection.Set("disconnected", now)
+	connection.Set("duration", int(now.Time().Sub(connection.GetDateTime("connected").Time()).Seconds()))
+	connection.Set("client_version", clientVersion)
+	connection.Set("close_reason", truncate(reason, 512))
+
+	return s.app.Save(connection)
+}
+
+func (s *deviceService) SetOffline(deviceID, connectionID string) error {
+	return s.app.RunInTransaction(func(txApp core.App) error {
+		presence, err := findPresence(txApp, deviceID)
+		if err != nil {
+			return err
+		}
+
+		if presence.GetString("connection") != connectionID || !presence.GetBool("online") {
+			// reconnected within the grace period
+			return nil
+		}
+
+		presence.Set("online", false)
+		presence.Set("last_seen", time.Now())
+
+		return txApp.Save(presence)
+	})
+}
+
+// findPresence returns the presence record of a device, a new unsaved one the first time
+func findPresence(app core.App, deviceID string) (*core.Record, error) {
+	presence, err := app.FindFirstRecordByData("ai_device_presence", "device", deviceID)
+	if err == nil {
+		return presence, nil
+	}
+
+	collection, err := app.FindCollectionByNameOrId("ai_device_presence")
+	if err != nil {
+		return nil, err
+	}
+
+	presence = core.NewRecord(collection)
+	presence.Set("device", deviceID)
+
+	return presence, nil
+}
+
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+
+	return s
+}
+
+func (s *deviceService) SaveTools(deviceID string, tools []DeviceTool) error {
+	record, err := s.app.FindRecordById("ai_device", deviceID)
+	if err != nil {
+		return err
+	}
+
+	record.Set("mcp_tools", tools)
+	record.Set("mcp_tools_updated", types.NowDateTime())
+	if err := s.app.Save(record); err != nil {
+		return fmt.Errorf("failed to save device tools: %w", err)
+	}
+
+	return nil
+}
@@ -1,32 +1,93 @@
 package services
 
 import (
+	"sync"
+	"time"
+
+	"github.com/phamviet/xiaozhi-hub/xiaozhi/store"
+	"github.com/phamviet/xiaozhi-hub/xiaozhi/types"
+	"github.com/pocketbase/dbx"
 	"github.com/pocketbase/pocketbase/core"
 )
 
 type HistoryService interface {
-	SaveMessage(sessionID string, role string, content string) error
+	SaveMessage(sessionID string, deviceID string, chatType types.ChatType, content string, wavAudio []byte) error
+	// Recent returns the last messages of an agent, oldest first
+	Recent(agentID string, limit int) ([]HistoryEntry, error)
+}
+
+// HistoryEntry is a chat message as shown outside the hub
+type HistoryEntry struct {
+	Role       string    `json:"role"` // user or assistant
+	Content    string    `json:"content"`
+	MacAddress string    `json:"mac_address"`
+	SessionID  string    `json:"session_id"`
+	Created    time.Time `json:"created"`
 }
 
 type historyService struct {
-	app core.App
+	app   core.App
+	store func() *store.Manager
 }
 
 func NewHistoryService(app core.App) HistoryService {
-	return &historyService{app: app}
+	return &historyService{
+		app:   app,
+		store: sync.OnceValue(func() *store.Manager { return store.NewManager(app) }),
+	}
+}
+
+// SaveMessage saves a chat message to history, the same way /xiaozhi/agent/chat-history/report does
+func (s *historyService) SaveMessage(sessionID string, deviceID string, chatType types.ChatType, content string, wavAudio []byte) error {
+	return s.store().SaveChatHistory(store.ChatHistoryParams{
+		ChatID:      sessionID,
+		DeviceID:    deviceID,
+		Content:     content,
+		ChatType:    string(chatType),
+		AudioBytes:  wavAudio,
+		ReportTime:  time.Now().UnixMilli(),
+		AudioFormat: "wav",
+	})
 }
 
-// SaveMessage saves a chat message to history
-func (s *historyService) SaveMessage(sessionID string, role string, content string) error {
-	collection, err := s.app.FindCollectionByNameOrId("ai_agent_chat_history")
+func (s *historyService) Recent(agentID string, limit int) ([]HistoryEntry, error) {
+	// rowid orders messages saved within the same millisecond
+	var records []*core.Record
+	err := s.app.RecordQuery(store.ChatHistoryCollectionName).
+		InnerJoin("ai_agent_chat", dbx.NewExp("[[ai_agent_chat.id]] = [[ai_agent_chat_history.chat]]")).
+		AndWhere(dbx.HashExp{"ai_agent_chat.agent": agentID}).
+		OrderBy("ai_agent_chat_history.created DESC", "ai_agent_chat_history.rowid DESC").
+		Limit(int64(limit)).
+		All(&records)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	record := core.NewRecord(collection)
-	record.Set("chat", sessionID)
-	record.Set("role", role)
-	record.Set("content", content)
+	if errs := s.app.ExpandRecords(records, []string{"device"}, nil); len(errs) > 0 {
+		s.app.Logger().Warn("failed to expand chat history devices", "errors", errs)
+	}
+
+	entries := make([]HistoryEntry, len(records))
+	for i, record := range records {
+		role := "user"
+		if types.ChatType(record.GetString("chat_type")) == types.ChatTypeAssistant {
+			role = "assistant"
+		}
+
+		macAddress := ""
+		if device := record.ExpandedOne("device"); device != nil {
+			macAddress = device.GetString("mac_address")
+		}
+
+		// newest first from the query
+		entries[len(records)-1-i] = HistoryEntry{
+			Role:       role,
+			Content:    record.GetString("content"),
+			MacAddress: macAddress,
+			SessionID:  record.GetString("chat"),
+			Created:    record.GetDateTime("created").Time(),
+		}
+	}
 
-	return s.app.Save(record)
+	return entries, nil
 }
@@ -0,0 +1,91 @@
+package services_test
+
+import (
+	"testing"
+
+	"github.com/phamviet/xiaozhi-hub/internal/hub/services"
+	_ "github.com/phamviet/xiaozhi-hub/migrations"
+	"github.com/phamviet/xiaozhi-hub/xiaozhi/types"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// newTestApp returns an app with the real migrated schema
+func newTestApp(t *testing.T) core.App {
+	t.Helper()
+
+	app := core.NewBaseApp(core.BaseAppConfig{DataDir: t.TempDir()})
+	if err := app.Bootstrap(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = app.ResetBootstrapState() })
+
+	if err := app.RunAllMigrations(); err != nil {
+		t.Fatal(err)
+	}
+
+	return app
+}
+
+func saveRecord(t *testing.T, app core.App, collection string, data map[string]any) *core.Record {
+	t.Helper()
+
+	c, err := app.FindCollectionByNameOrId(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record := core.NewRecord(c)
+	record.Load(data)
+	// fixtures only set what the query needs
+	if err := app.SaveNoValidate(record); err != nil {
+		t.Fatal(err)
+	}
+
+	return record
+}
+
+func TestHistoryRecent(t *testing.T) {
+	app := newTestApp(t)
+
+	agent := saveRecord(t, app, "ai_agent", map[string]any{"agent_name": "Tutor"})
+	other := saveRecord(t, app, "ai_agent", map[string]any{"agent_name": "Other"})
+	device := saveRecord(t, app, "ai_device", map[string]any{"mac_address": "aa:bb:cc:dd:ee:ff", "agent": agent.Id})
+	chat := saveRecord(t, app, "ai_agent_chat", map[string]any{"agent": agent.Id, "device": device.Id})
+	otherChat := saveRecord(t, app, "ai_agent_chat", map[string]any{"agent": other.Id})
+
+	history := services.NewHistoryService(app)
+	for _, m := range []struct {
+		chat     string
+		chatType types.ChatType
+		content  string
+	}{
+		{chat.Id, types.TypeUser, "hello"},
+		{otherChat.Id, types.TypeUser, "not mine"},
+		{chat.Id, types.ChatTypeAssistant, "hi there"},
+		{chat.Id, types.TypeUser, "bye"},
+	} {
+		if err := history.SaveMessage(m.chat, device.Id, m.chatType, m.content, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := history.Recent(agent.Id, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("Recent() returned %d entries, want 2", len(entries))
+	}
+
+	want := []services.HistoryEntry{
+		{Role: "assistant", Content: "hi there", MacAddress: "aa:bb:cc:dd:ee:ff", SessionID: chat.Id},
+		{Role: "user", Content: "bye", MacAddress: "aa:bb:cc:dd:ee:ff", SessionID: chat.Id},
+	}
+	for i, entry := range entries {
+		entry.Created = want[i].Created
+		if entry != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, entry, want[i])
+		}
+	}
+}
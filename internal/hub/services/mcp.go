@@ -0,0 +1,94 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/dbx"
+)
+
+const (
+	MCPTransportStdio = "stdio"
+	MCPTransportHTTP  = "http"
+
+	// DefaultMCPCallTimeout applies when a server has no timeout
+	DefaultMCPCallTimeout = 30 * time.Second
+)
+
+// MCPServer is an external MCP server whose tools an agent can call
+type MCPServer struct {
+	Name          string
+	Transport     string
+	Command       string
+	Args          []string
+	Env           []string // KEY=value
+	URL           string
+	Headers       map[string]string
+	DisabledTools []string
+	Timeout       time.Duration
+}
+
+// GetMCPServers returns the enabled MCP servers of an agent with the credential resolved into the headers.
+// A header value may reference the credential as {{api_key}}, without headers it is sent as a bearer token.
+func (s *agentService) GetMCPServers(agentID string) ([]MCPServer, error) {
+	records, err := s.app.FindRecordsByFilter("ai_agent_mcp_server", "agent = {:agent} && enabled = true", "name", 0, 0, dbx.Params{"agent": agentID})
+	if err != nil {
+		return nil, err
+	}
+
+	servers := make([]MCPServer, 0, len(records))
+	for _, record := range records {
+		server := MCPServer{
+			Name:      record.GetString("name"),
+			Transport: record.GetString("transport"),
+			Command:   record.GetString("command"),
+			URL:       record.GetString("url"),
+			Headers:   map[string]string{},
+			Timeout:   time.Duration(record.GetInt("timeout")) * time.Second,
+		}
+		if server.Timeout <= 0 {
+			server.Timeout = DefaultMCPCallTimeout
+		}
+
+		env := map[string]string{}
+		for _, field := range []struct {
+			name string
+			into any
+		}{
+			{"args", &server.Args},
+			{"env", &env},
+			{"headers", &server.Headers},
+			{"disabled_tools", &server.DisabledTools},
+		} {
+			if raw := record.GetString(field.name); raw == "" || raw == "null" {
+				continue
+			}
+			if err := record.UnmarshalJSONField(field.name, field.into); err != nil {
+				return nil, fmt.Errorf("mcp server %q has an invalid %s: %w", server.Name, field.name, err)
+			}
+		}
+		for k, v := range env {
+			server.Env = append(server.Env, k+"="+v)
+		}
+
+		if credentialID := record.GetString("credential"); credentialID != "" {
+			credential, err := s.app.FindRecordById("user_credentials", credentialID)
+			if err != nil {
+				return nil, fmt.Errorf("mcp server %q credential: %w", server.Name, err)
+			}
+
+			apiKey := credential.GetString("api_key")
+			if len(server.Headers) == 0 {
+				server.Headers["Authorization"] = "Bearer " + apiKey
+			}
+			for k, v := range server.Headers {
+				server.Headers[k] = strings.ReplaceAll(v, "{{api_key}}", apiKey)
+			}
+		}
+
+		servers = append(servers, server)
+	}
+
+	return servers, nil
+}
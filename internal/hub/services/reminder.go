@@ -0,0 +1,314 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/cron"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+const (
+	ReminderModeFixed    = "fixed"
+	ReminderModeGenerate = "generate"
+
+	DeliveryPending   = "pending"
+	DeliverySending   = "sending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+var ErrInvalidReminder = errors.New("invalid reminder")
+
+// Reminder is a one-shot (RunAt) or repeating (Schedule, a cron expression) announcement.
+// An empty DeviceID targets every device of the agent.
+type Reminder struct {
+	ID       string
+	AgentID  string
+	DeviceID string
+	Message  string
+	Mode     string
+	Schedule string
+	RunAt    time.Time
+	Timezone string
+	Source   string
+}
+
+// Delivery is a reminder firing for one device
+type Delivery struct {
+	ID       string
+	DeviceID string
+	Text     string
+	Mode     string
+}
+
+type ReminderService interface {
+	Create(r Reminder) (*Reminder, error)
+	// Due returns the enabled reminders to fire at now, they must then be passed to MarkRun
+	Due(now time.Time) ([]Reminder, error)
+	// MarkRun records the firing, one-shot reminders are disabled
+	MarkRun(r Reminder, now time.Time) error
+	// Queue creates a pending delivery for every target device of the reminder,
+	// a repeating reminder reuses the delivery still pending from an earlier firing
+	Queue(r Reminder) ([]Delivery, error)
+	// Claim marks the pending deliveries of a device as being sent, only deliveryID when not empty,
+	// nothing else will send them
+	Claim(deviceID, deliveryID string) ([]Delivery, error)
+	// Finish records the outcome of a claimed delivery, retry puts it back in the queue
+	Finish(deliveryID string, err error, retry bool) error
+	// Release puts every claimed delivery back in the queue, at startup their sender is gone
+	Release() (int, error)
+	// Location is the default timezone of reminders, `server.timezone`
+	Location() *time.Location
+}
+
+type reminderService struct {
+	app core.App
+}
+
+func NewReminderService(app core.App) ReminderService {
+	return &reminderService{app: app}
+}
+
+func (s *reminderService) Location() *time.Location {
+	if loc, err := time.LoadLocation(sysParam(s.app, "server.timezone")); err == nil {
+		return loc
+	}
+
+	return time.UTC
+}
+
+func (s *reminderService) Create(r Reminder) (*Reminder, error) {
+	if r.Message == "" || r.AgentID == "" || (r.Schedule == "") == r.RunAt.IsZero() {
+		return nil, fmt.Errorf("%w: a message and either a schedule or a time are required", ErrInvalidReminder)
+	}
+
+	if r.Schedule != "" {
+		if _, err := cron.NewSchedule(r.Schedule); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidReminder, err)
+		}
+	}
+
+	if r.Mode == "" {
+		r.Mode = ReminderModeFixed
+	}
+	if r.Timezone == "" {
+		r.Timezone = s.Location().String()
+	}
+
+	collection, err := s.app.FindCollectionByNameOrId("ai_reminder")
+	if err != nil {
+		return nil, err
+	}
+
+	record := core.NewRecord(collection)
+	record.Set("agent", r.AgentID)
+	record.Set("device", r.DeviceID)
+	record.Set("message", r.Message)
+	record.Set("mode", r.Mode)
+	record.Set("schedule", r.Schedule)
+	if !r.RunAt.IsZero() {
+		record.Set("run_at", r.RunAt)
+	}
+	record.Set("timezone", r.Timezone)
+	record.Set("source", r.Source)
+	record.Set("enabled", true)
+	if err := s.app.Save(record); err != nil {
+		return nil, fmt.Errorf("failed to save reminder: %w", err)
+	}
+
+	r.ID = record.Id
+
+	return &r, nil
+}
+
+func (s *reminderService) Due(now time.Time) ([]Reminder, error) {
+	records, err := s.app.FindRecordsByFilter("ai_reminder",
+		"enabled = true && (schedule != '' || (run_at != '' && run_at <= {:now} && last_run = ''))",
+		"", 0, 0, dbx.Params{"now": now.UTC().Format(types.DefaultDateLayout)})
+	if err != nil {
+		return nil, err
+	}
+
+	var due []Reminder
+	for _, record := range records {
+		r := reminderFromRecord(record)
+		if r.Schedule == "" {
+			due = append(due, r)
+			continue
+		}
+
+		schedule, err := cron.NewSchedule(r.Schedule)
+		if err != nil {
+			s.app.Logger().Warn("invalid reminder schedule", "reminder", r.ID, "schedule", r.Schedule, "error", err)
+			continue
+		}
+
+		loc, err := time.LoadLocation(r.Timezone)
+		if err != nil {
+			loc = s.Location()
+		}
+
+		// the job runs every minute, last_run guards against a second tick within the same one
+		lastRun := record.GetDateTime("last_run").Time()
+		if schedule.IsDue(cron.NewMoment(now.In(loc))) && now.Truncate(time.Minute).After(lastRun) {
+			due = append(due, r)
+		}
+	}
+
+	return due, nil
+}
+
+func (s *reminderService) MarkRun(r Reminder, now time.Time) error {
+	record, err := s.app.FindRecordById("ai_reminder", r.ID)
+	if err != nil {
+		return err
+	}
+
+	record.Set("last_run", now)
+	if r.Schedule == "" {
+		record.Set("enabled", false)
+	}
+
+	return s.app.Save(record)
+}
+
+func (s *reminderService) Queue(r Reminder) ([]Delivery, error) {
+	deviceIDs := []string{r.DeviceID}
+	if r.DeviceID == "" {
+		records, err := s.app.FindRecordsByFilter("ai_device", "agent = {:agent} && status = 'bound'", "", 0, 0, dbx.Params{"agent": r.AgentID})
+		if err != nil {
+			return nil, err
+		}
+
+		deviceIDs = deviceIDs[:0]
+		for _, record := range records {
+			deviceIDs = append(deviceIDs, record.Id)
+		}
+	}
+
+	collection, err := s.app.FindCollectionByNameOrId("ai_reminder_delivery")
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]Delivery, 0, len(deviceIDs))
+	for _, deviceID := range deviceIDs {
+		record := core.NewRecord(collection)
+		if r.Schedule != "" {
+			// an offline device gets a repeating reminder once when it connects, not once per missed firing
+			pending, err := s.app.FindFirstRecordByFilter("ai_reminder_delivery", "reminder = {:reminder} && device = {:device} && status = {:status}",
+				dbx.Params{"reminder": r.ID, "device": deviceID, "status": DeliveryPending})
+			if err == nil {
+				record = pending
+			} else if !errors.Is(err, sql.ErrNoRows) {
+				return deliveries, fmt.Errorf("failed to queue reminder: %w", err)
+			}
+		}
+
+		record.Set("reminder", r.ID)
+		record.Set("device", deviceID)
+		record.Set("text", r.Message)
+		record.Set("mode", r.Mode)
+		record.Set("status", DeliveryPending)
+		if err := s.app.Save(record); err != nil {
+			return deliveries, fmt.Errorf("failed to queue reminder: %w", err)
+		}
+
+		deliveries = append(deliveries, Delivery{ID: record.Id, DeviceID: deviceID, Text: r.Message, Mode: r.Mode})
+	}
+
+	return deliveries, nil
+}
+
+func (s *reminderService) Claim(deviceID, deliveryID string) ([]Delivery, error) {
+	filter := "device = {:device} && status = {:status}"
+	params := dbx.Params{"device": deviceID, "status": DeliveryPending}
+	if deliveryID != "" {
+		filter += " && id = {:id}"
+		params["id"] = deliveryID
+	}
+
+	var claimed []Delivery
+	err := s.app.RunInTransaction(func(txApp core.App) error {
+		records, err := txApp.FindRecordsByFilter("ai_reminder_delivery", filter, "created", 0, 0, params)
+		if err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			record.Set("status", DeliverySending)
+			if err := txApp.Save(record); err != nil {
+				return err
+			}
+
+			claimed = append(claimed, Delivery{
+				ID:       record.Id,
+				DeviceID: deviceID,
+				Text:     record.GetString("text"),
+				Mode:     record.GetString("mode"),
+			})
+		}
+
+		return nil
+	})
+
+	return claimed, err
+}
+
+func (s *reminderService) Finish(deliveryID string, err error, retry bool) error {
+	record, findErr := s.app.FindRecordById("ai_reminder_delivery", deliveryID)
+	if findErr != nil {
+		return findErr
+	}
+
+	switch {
+	case err == nil:
+		record.Set("status", DeliveryDelivered)
+		record.Set("delivered", types.NowDateTime())
+	case retry:
+		record.Set("status", DeliveryPending)
+	default:
+		record.Set("status", DeliveryFailed)
+	}
+	if err != nil {
+		record.Set("error", truncate(err.Error(), 512))
+	}
+
+	return s.app.Save(record)
+}
+
+func (s *reminderService) Release() (int, error) {
+	records, err := s.app.FindRecordsByFilter("ai_reminder_delivery", "status = {:status}", "", 0, 0,
+		dbx.Params{"status": DeliverySending})
+	if err != nil {
+		return 0, err
+	}
+
+	for i, record := range records {
+		record.Set("status", DeliveryPending)
+		if err := s.app.Save(record); err != nil {
+			return i, err
+		}
+	}
+
+	return len(records), nil
+}
+
+func reminderFromRecord(record *core.Record) Reminder {
+	return Reminder{
+		ID:       record.Id,
+		AgentID:  record.GetString("agent"),
+		DeviceID: record.GetString("device"),
+		Message:  record.GetString("message"),
+		Mode:     record.GetString("mode"),
+		Schedule: record.GetString("schedule"),
+		RunAt:    record.GetDateTime("run_at").Time(),
+		Timezone: record.GetString("timezone"),
+		Source:   record.GetString("source"),
+	}
+}
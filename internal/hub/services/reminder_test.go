@@ -0,0 +1,169 @@
+package services_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/phamviet/xiaozhi-hub/internal/hub/services"
+)
+
+func TestReminderDue(t *testing.T) {
+	app := newTestApp(t)
+	reminders := services.NewReminderService(app)
+	agent := saveRecord(t, app, "ai_agent", map[string]any{"agent_name": "Tutor"})
+
+	// 08:00 in Ho Chi Minh City
+	now := time.Date(2026, 1, 5, 1, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		reminder services.Reminder
+		want     bool
+	}{
+		{"one-shot due", services.Reminder{RunAt: now.Add(-time.Minute)}, true},
+		{"one-shot not yet", services.Reminder{RunAt: now.Add(time.Hour)}, false},
+		{"cron in zone", services.Reminder{Schedule: "0 8 * * *", Timezone: "Asia/Ho_Chi_Minh"}, true},
+		{"cron in utc", services.Reminder{Schedule: "0 8 * * *", Timezone: "UTC"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.reminder.AgentID = agent.Id
+			tt.reminder.Message = tt.name
+			r, err := reminders.Create(tt.reminder)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := isDue(t, reminders, r.ID, now); got != tt.want {
+				t.Fatalf("due = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReminderDueOncePerMinute(t *testing.T) {
+	app := newTestApp(t)
+	reminders := services.NewReminderService(app)
+	agent := saveRecord(t, app, "ai_agent", map[string]any{"agent_name": "Tutor"})
+
+	r, err := reminders.Create(services.Reminder{AgentID: agent.Id, Message: "stretch", Schedule: "* * * * *"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 1, 5, 1, 0, 5, 0, time.UTC)
+	if !isDue(t, reminders, r.ID, now) {
+		t.Fatal("not due on the first tick")
+	}
+	if err := reminders.MarkRun(*r, now); err != nil {
+		t.Fatal(err)
+	}
+
+	if isDue(t, reminders, r.ID, now.Add(30*time.Second)) {
+		t.Fatal("due again within the same minute")
+	}
+	if !isDue(t, reminders, r.ID, now.Add(time.Minute)) {
+		t.Fatal("not due in the next minute")
+	}
+}
+
+func TestReminderDeliveries(t *testing.T) {
+	app := newTestApp(t)
+	reminders := services.NewReminderService(app)
+	agent := saveRecord(t, app, "ai_agent", map[string]any{"agent_name": "Tutor"})
+	device := saveRecord(t, app, "ai_device", map[string]any{"mac_address": "aa:bb:cc:dd:ee:ff", "agent": agent.Id})
+
+	r, err := reminders.Create(services.Reminder{AgentID: agent.Id, DeviceID: device.Id, Message: "stretch", Schedule: "0 * * * *"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queued := queue(t, reminders, *r)
+	if again := queue(t, reminders, *r); again.ID != queued.ID {
+		t.Fatalf("repeating reminder queued %s next to pending %s", again.ID, queued.ID)
+	}
+
+	claim(t, reminders, device.Id, "", queued.ID)
+	claim(t, reminders, device.Id, "")
+
+	// the device went away while playing
+	if err := reminders.Finish(queued.ID, errors.New("not ready"), true); err != nil {
+		t.Fatal(err)
+	}
+	claim(t, reminders, device.Id, queued.ID, queued.ID)
+
+	// sending when the hub restarted
+	released, err := reminders.Release()
+	if err != nil || released != 1 {
+		t.Fatalf("Release() = %d, %v, want 1", released, err)
+	}
+	claim(t, reminders, device.Id, "", queued.ID)
+
+	if err := reminders.Finish(queued.ID, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if released, err := reminders.Release(); err != nil || released != 0 {
+		t.Fatalf("Release() = %d, %v, want 0", released, err)
+	}
+
+	next := queue(t, reminders, *r)
+	if next.ID == queued.ID {
+		t.Fatal("delivered delivery queued again")
+	}
+
+	other, err := reminders.Create(services.Reminder{AgentID: agent.Id, DeviceID: device.Id, Message: "drink", RunAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue(t, reminders, *other)
+	claim(t, reminders, device.Id, next.ID, next.ID)
+}
+
+func isDue(t *testing.T, reminders services.ReminderService, id string, now time.Time) bool {
+	t.Helper()
+
+	due, err := reminders.Due(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range due {
+		if r.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func queue(t *testing.T, reminders services.ReminderService, r services.Reminder) services.Delivery {
+	t.Helper()
+
+	deliveries, err := reminders.Queue(r)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("Queue() = %+v, %v, want one delivery", deliveries, err)
+	}
+
+	return deliveries[0]
+}
+
+// claim checks that exactly want are claimed
+func claim(t *testing.T, reminders services.ReminderService, deviceID, deliveryID string, want ...string) {
+	t.Helper()
+
+	claimed, err := reminders.Claim(deviceID, deliveryID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(claimed) != len(want) {
+		t.Fatalf("Claim(%q) = %+v, want %v", deliveryID, claimed, want)
+	}
+	for i, d := range claimed {
+		if d.ID != want[i] {
+			t.Fatalf("Claim(%q) = %+v, want %v", deliveryID, claimed, want)
+		}
+	}
+}
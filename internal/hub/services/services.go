@@ -1,19 +1,56 @@
 package services
 
-import "github.com/pocketbase/pocketbase/core"
+import (
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
 
 // ServiceContainer holds references to all services
 type ServiceContainer struct {
-	Device  DeviceService
-	Session SessionService
-	History HistoryService
+	Agent    AgentService
+	Auth     AuthService
+	Device   DeviceService
+	Session  SessionService
+	History  HistoryService
+	Reminder ReminderService
 }
 
 // NewServiceContainer creates a new service container
 func NewServiceContainer(app core.App) *ServiceContainer {
 	return &ServiceContainer{
-		Device:  NewDeviceService(app),
-		Session: NewSessionService(app),
-		History: NewHistoryService(app),
+		Agent:    NewAgentService(app),
+		Auth:     NewAuthService(app),
+		Device:   NewDeviceService(app),
+		Session:  NewSessionService(app),
+		History:  NewHistoryService(app),
+		Reminder: NewReminderService(app),
+	}
+}
+
+// sysParam returns the value of a sys_params record, empty when it does not exist
+func sysParam(app core.App, name string) string {
+	record, err := app.FindFirstRecordByData("sys_params", "name", name)
+	if err != nil {
+		return ""
 	}
+
+	return record.GetString("value")
+}
+
+// secondsParam reads a duration in seconds from sys_params, fallback is used when it is unset or invalid
+func secondsParam(app core.App, name string, fallback time.Duration) time.Duration {
+	value := sysParam(app, name)
+	if value == "" {
+		return fallback
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		app.Logger().Warn("invalid sys param, using default", "name", name, "value", value)
+		return fallback
+	}
+
+	return time.Duration(seconds) * time.Second
 }
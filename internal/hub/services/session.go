@@ -1,11 +1,19 @@
 package services
 
 import (
+	"time"
+
 	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
 )
 
+// DefaultResumeWindow is used when `chat.resume_window` is not configured
+const DefaultResumeWindow = 10 * time.Minute
+
 type SessionService interface {
 	CreateSession(deviceID string) (string, error)
+	LoadContext(sessionID string, v any) error
+	SaveContext(sessionID string, v any) error
 }
 
 type sessionService struct {
@@ -16,13 +24,27 @@ func NewSessionService(app core.App) SessionService {
 	return &sessionService{app: app}
 }
 
-// CreateSession creates a new chat session record
+// CreateSession creates a new chat session record, or resumes the latest one of the device
+// when it reconnects within `chat.resume_window` seconds
 func (s *sessionService) CreateSession(deviceID string) (string, error) {
 	device, err := s.app.FindRecordById("ai_device", deviceID)
 	if err != nil {
 		return "", err
 	}
 
+	agentID := device.GetString("agent")
+	if window := secondsParam(s.app, "chat.resume_window", DefaultResumeWindow); window > 0 {
+		since := time.Now().Add(-window).UTC().Format(types.DefaultDateLayout)
+		records, err := s.app.FindRecordsByFilter("ai_agent_chat",
+			"device = {:device} && agent = {:agent} && updated >= {:since}",
+			"-updated", 1, 0,
+			map[string]any{"device": deviceID, "agent": agentID, "since": since},
+		)
+		if err == nil && len(records) > 0 {
+			return records[0].Id, nil
+		}
+	}
+
 	// todo: check field `chat_history_enabled`
 	collection, err := s.app.FindCollectionByNameOrId("ai_agent_chat")
 	if err != nil {
@@ -30,7 +52,8 @@ func (s *sessionService) CreateSession(deviceID string) (string, error) {
 	}
 
 	record := core.NewRecord(collection)
-	record.Set("agent", device.GetString("agent"))
+	record.Set("agent", agentID)
+	record.Set("device", deviceID)
 
 	if err := s.app.Save(record); err != nil {
 		return "", err
@@ -38,3 +61,28 @@ func (s *sessionService) CreateSession(deviceID string) (string, error) {
 
 	return record.Id, nil
 }
+
+// LoadContext decodes the LLM context saved for the session into v, v is untouched when there is none
+func (s *sessionService) LoadContext(sessionID string, v any) error {
+	record, err := s.app.FindRecordById("ai_agent_chat", sessionID)
+	if err != nil {
+		return err
+	}
+
+	if raw := record.GetString("context"); raw == "" || raw == "null" {
+		return nil
+	}
+
+	return record.UnmarshalJSONField("context", v)
+}
+
+// SaveContext stores the LLM context of the session, it also marks the session as recently active
+func (s *sessionService) SaveContext(sessionID string, v any) error {
+	record, err := s.app.FindRecordById("ai_agent_chat", sessionID)
+	if err != nil {
+		return err
+	}
+
+	record.Set("context", v)
+	return s.app.Save(record)
+}
@@ -1,38 +1,39 @@
 package ws
 
 import (
+	"bytes"
 	"context"
-	"encoding/base64"
 	"fmt"
+	"io"
 	"math/rand/v2"
-	"os"
 	"slices"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/core"
 	"github.com/firebase/genkit/go/core/x/session"
 	"github.com/firebase/genkit/go/genkit"
 	"github.com/firebase/genkit/go/plugins/googlegenai"
-	"github.com/firebase/genkit/go/plugins/mcp"
 	"github.com/phamviet/xiaozhi-hub/internal/audio"
+	"github.com/phamviet/xiaozhi-hub/internal/emotion"
+	"github.com/phamviet/xiaozhi-hub/internal/sentence"
 	"github.com/phamviet/xiaozhi-hub/internal/tts"
-	"github.com/phamviet/xiaozhi-hub/internal/wav"
-	"google.golang.org/genai"
 )
 
 type ChatState struct {
-	Device  string   `json:"device"`
-	History []string `json:"history"`
+	Device string `json:"device"`
 }
 
 type AgentConfig struct {
-	SystemPrompt string   `json:"system_prompt"`
-	LLMModel     string   `json:"llm_model"`
-	TTSModel     string   `json:"tts_model"`
-	WakeWords    []string `json:"wake_words"`
-	QuickReplies []string `json:"quick_replies"`
+	SystemPrompt       string   `json:"system_prompt"`
+	Language           string   `json:"language"`
+	HistoryMaxMessages int      `json:"history_max_messages"`
+	HistoryMaxTokens   int      `json:"history_max_tokens"`
+	LLMModel           string   `json:"llm_model"`
+	WakeWords          []string `json:"wake_words"`
+	QuickReplies       []string `json:"quick_replies"`
 }
 
 type AgentOption func(*AgentConfig)
@@ -49,86 +50,85 @@ func WithLlmModel(model string) AgentOption {
 	}
 }
 
-func WithTtsModel(model string) AgentOption {
-	return func(c *AgentConfig) {
-		c.TTSModel = model
-	}
-}
-
 func NewAgentConfig() *AgentConfig {
 	cfg := &AgentConfig{
 		SystemPrompt: "You are a helpful assistant. Use the appropriate tool based on user intent",
 		LLMModel:     "googleai/gemini-2.5-flash", // gemini-2.5-flash-lite
-		TTSModel:     "googleai/gemini-2.5-flash-preview-tts",
 		WakeWords:    []string{"hi", "test", "genkit", "go"},
 		QuickReplies: []string{"hi", "Hello! How can I assist you today?"},
+
+		HistoryMaxMessages: DefaultHistoryMaxMessages,
+		HistoryMaxTokens:   DefaultHistoryMaxTokens,
 	}
 
 	return cfg
 }
 
-const sampleText = "Genkit is the best Gen AI library!"
+// agentConfig builds the LLM config from the agent bound to the device
+func (c *Client) agentConfig() *AgentConfig {
+	cfg := NewAgentConfig()
+	if c.agent == nil {
+		return cfg
+	}
 
-func (c *Client) initializeAgent(cfg *AgentConfig) {
-	if cfg == nil {
-		cfg = NewAgentConfig()
+	rolePrompt := c.agent.RolePrompt
+	if strings.TrimSpace(rolePrompt) == "" {
+		rolePrompt = cfg.SystemPrompt
 	}
 
-	c.g = genkit.Init(c.ctx, genkit.WithDefaultModel(cfg.LLMModel), genkit.WithPlugins(&googlegenai.GoogleAI{}))
-	c.initInternalTools()
+	basePrompt := c.services.Agent.GetSysParam("agent.base_prompt")
+	cfg.SystemPrompt = composeSystemPrompt(basePrompt, rolePrompt, c.agent.SummaryMemory, c.agent.LangCode) +
+		"\n\n" + emotion.PromptHint()
+	cfg.Language = c.agent.LangCode
 
-	// connect to the device's mcp server
-	client, err := mcp.NewClient(c.ctx, mcp.MCPClientOptions{
-		Name:      "xiaozhi-hub-client",
-		Transport: c.mcpTransport,
-	})
-	if err != nil {
-		c.logger.Error("Failed to create MCP client", "error", err)
-		return
+	if n, err := strconv.Atoi(c.services.Agent.GetSysParam("llm.history_max_messages")); err == nil && n >= 0 {
+		cfg.HistoryMaxMessages = n
+	}
+	if n, err := strconv.Atoi(c.services.Agent.GetSysParam("llm.history_max_tokens")); err == nil && n >= 0 {
+		cfg.HistoryMaxTokens = n
 	}
 
-	// Get tools
-	tools, _ := client.GetActiveTools(c.ctx, c.g)
-	c.logger.Info("Found MCP time tools", "count", len(tools))
-	for _, tool := range tools {
-		c.tools = append(c.tools, tool)
+	return cfg
+}
+
+// composeSystemPrompt joins the server wide base prompt, the agent persona and its long-term memory
+func composeSystemPrompt(basePrompt, rolePrompt, memory, language string) string {
+	var parts []string
+	if s := strings.TrimSpace(basePrompt); s != "" {
+		parts = append(parts, s)
+	}
+	if s := strings.TrimSpace(rolePrompt); s != "" {
+		parts = append(parts, s)
+	}
+	if s := strings.TrimSpace(memory); s != "" {
+		parts = append(parts, "<memory>\n"+s+"\n</memory>")
+	}
+	if language != "" {
+		parts = append(parts, fmt.Sprintf("Always reply in the language with code %q unless the user asks for another one.", language))
 	}
 
-	c.ttsFlow = genkit.DefineFlow(c.g, "tts", func(ctx context.Context, input string) (*tts.Output, error) {
-		if strings.HasPrefix(input, "Genkit") {
-			return tts.NewOutputFromFile("sample/lt30.wav", 24000, 1, 16)
-		}
+	return strings.Join(parts, "\n\n")
+}
 
-		resp, err := genkit.Generate(ctx, c.g,
-			ai.WithModelName(cfg.TTSModel),
-			ai.WithConfig(&genai.GenerateContentConfig{
-				Temperature:        genai.Ptr[float32](1.0),
-				ResponseModalities: []string{"AUDIO"},
-				SpeechConfig: &genai.SpeechConfig{
-					VoiceConfig: &genai.VoiceConfig{
-						PrebuiltVoiceConfig: &genai.PrebuiltVoiceConfig{
-							VoiceName: "Algenib",
-						},
-					},
-				},
-			}),
-			ai.WithPrompt(fmt.Sprintf("Say: %s", input)))
-		if err != nil {
-			return nil, err
-		}
+const sampleText = "Genkit is the best Gen AI library!"
 
-		part := resp.Message.Content[0]
-		prefix := fmt.Sprintf("data:%s;base64,", part.ContentType)
-		base64Encoded := part.Text[len(prefix):]
-		rawBytes, err := base64.StdEncoding.DecodeString(base64Encoded)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode base64 audio: %w", err)
-		}
+// mcpClientName also prefixes the genkit names of the device tools
+const mcpClientName = "xiaozhi-hub-client"
 
-		return tts.NewOutput(rawBytes, 24000, 1, 16)
-	})
+func (c *Client) initializeAgent(cfg *AgentConfig) {
+	if cfg == nil {
+		cfg = NewAgentConfig()
+	}
 
-	c.chatFlow = genkit.DefineFlow(c.g, "chat", func(ctx context.Context, input string) (string, error) {
+	c.loadChatContext()
+
+	c.g = genkit.Init(c.ctx, genkit.WithDefaultModel(cfg.LLMModel), genkit.WithPlugins(&googlegenai.GoogleAI{}))
+	c.initInternalTools()
+	c.tools = append(c.tools, c.connectMCPServers()...)
+
+	c.connectDeviceTools()
+
+	c.chatFlow = genkit.DefineStreamingFlow(c.g, "chat", func(ctx context.Context, input string, sendChunk core.StreamCallback[string]) (string, error) {
 		if input == "genkit" || input == "go" {
 			return sampleText, nil
 		}
@@ -162,16 +162,25 @@ func (c *Client) initializeAgent(cfg *AgentConfig) {
 			//ai.WithModel(googlegenai.ModelRef("googleai/gemini-2.5-flash", &genai.GenerateContentConfig{
 			//	ThinkingConfig: &genai.ThinkingConfig{ThinkingBudget: genai.Ptr[int32](0)},
 			//})),
-			ai.WithTools(c.tools...),
+			ai.WithTools(c.llmTools()...),
 			ai.WithToolChoice(ai.ToolChoiceAuto),
-			ai.WithSystem(cfg.SystemPrompt),
+			ai.WithSystem(cfg.SystemPrompt+c.timePrompt()+c.iotStatePrompt()),
+			ai.WithMessages(c.chatHistory()...),
 			ai.WithPrompt(input),
+			ai.WithStreaming(func(ctx context.Context, chunk *ai.ModelResponseChunk) error {
+				if text := chunk.Text(); text != "" {
+					return sendChunk(ctx, text)
+				}
+				return nil
+			}),
 		)
 
 		if err != nil {
 			return "", err
 		}
 
+		c.updateChatHistory(resp.History(), cfg)
+
 		return resp.Text(), nil
 	})
 
@@ -183,115 +192,79 @@ func (c *Client) Chat(ctx context.Context, text string) {
 		return
 	}
 
-	result, err := c.chatFlow.Run(ctx, text)
-	if err != nil {
-		c.logger.Error("chat.flow", "error", err)
-		return
-	}
-
-	_ = c.SendTtsStart(c.sampleRate)
+	// send the final transcript right away, the LLM may take a while
 	_ = c.SendSttMessage(text)
-	// send llm intent
 
-	lines := strings.SplitSeq(result, "\n")
-	var nonEmptyLines []string
-	for line := range lines {
-		if line != "" {
-			nonEmptyLines = append(nonEmptyLines, line)
+	speaker := c.newSpeaker(ctx)
+	splitter := sentence.NewSplitter()
+	// head keeps the raw text before the first sentence, the splitter drops an emoji-only first line
+	var head strings.Builder
+	first := true
+	say := func(s string) {
+		// the first sentence always sets the face, later ones only when they carry an emoji
+		feeling, ok := emotion.Detect(s)
+		if first {
+			if feeling, ok = emotion.Detect(head.String() + s); !ok {
+				feeling = emotion.Neutral
+			}
 		}
-	}
+		first = false
+		_ = c.SendLlmMessage(s, feeling)
 
-	if len(nonEmptyLines) == 0 {
-		time.Sleep(time.Duration(500) * time.Millisecond)
-		_ = c.SendTtsStop()
-		return
-	}
-
-	type ttsResult struct {
-		text     string
-		filename string
-		err      error
+		if s = emotion.Strip(s); s != "" {
+			speaker.Say(s)
+		}
 	}
 
-	// Process TTS in parallel but stream in order as soon as each is ready
-	results := make([]ttsResult, len(nonEmptyLines))
-	readyChan := make(chan int, len(nonEmptyLines))
-	var mu sync.Mutex
-	var wg sync.WaitGroup
-
-	for i, line := range nonEmptyLines {
-		wg.Add(1)
-		go func(idx int, l string) {
-			defer wg.Done()
-			output, err := c.ttsFlow.Run(c.ctx, l)
-			if err != nil {
-				c.logger.Error("ttsFlow.Run", "error", err, "text", l)
-				mu.Lock()
-				results[idx] = ttsResult{err: err}
-				mu.Unlock()
-				readyChan <- idx
-				return
-			}
-			filename, err := wav.EncodeTts(output)
-			if err != nil {
-				c.logger.Error("wav.EncodeTts", "error", err, "text", l)
-				mu.Lock()
-				results[idx] = ttsResult{err: err}
-				mu.Unlock()
-				readyChan <- idx
-				return
+	var result string
+	spoken := false
+	for value, err := range c.chatFlow.Stream(ctx, text) {
+		if err != nil {
+			if ctx.Err() == nil {
+				c.logger.Error("chat.flow", "error", err)
 			}
-			mu.Lock()
-			results[idx] = ttsResult{text: l, filename: filename}
-			mu.Unlock()
-			readyChan <- idx
-		}(i, line)
-	}
+			break
+		}
 
-	go func() {
-		wg.Wait()
-		close(readyChan)
-	}()
-
-	// Stream in order as results become available
-	nextIdx := 0
-	completed := make([]bool, len(nonEmptyLines))
-
-	for nextIdx < len(nonEmptyLines) {
-		// Check if next index is already ready
-		mu.Lock()
-		isReady := completed[nextIdx]
-		mu.Unlock()
-
-		if isReady {
-			res := results[nextIdx]
-			if res.err == nil {
-				c.streamTtsFile(res.text, res.filename)
-			}
-			nextIdx++
-			continue
+		if value.Done {
+			result = value.Output
+			break
 		}
 
-		// Wait for next completion
-		idx, ok := <-readyChan
-		if !ok {
-			break // Channel closed, all done
+		if first {
+			head.WriteString(value.Stream)
 		}
+		for _, s := range splitter.Push(value.Stream) {
+			spoken = true
+			say(s)
+		}
+	}
 
-		mu.Lock()
-		completed[idx] = true
-		mu.Unlock()
+	if spoken {
+		if rest := splitter.Flush(); rest != "" {
+			say(rest)
+		}
+	} else {
+		// canned replies are returned without streaming
+		for _, s := range sentence.Split(result) {
+			say(s)
+		}
+	}
 
-		// If this is the next expected index, stream it
-		if idx == nextIdx {
-			res := results[nextIdx]
-			if res.err == nil {
-				c.streamTtsFile(res.text, res.filename)
-			}
-			nextIdx++
+	speaker.Close()
+	c.saveAssistantMessage(result, speaker.recording, speaker.recordingRate)
+
+	if ctx.Err() != nil {
+		// interrupted, the device stops playback and goes back to listening
+		if speaker.started {
+			_ = c.SendTtsStop()
 		}
+		return
 	}
 
+	if !speaker.started {
+		_ = c.SendTtsStart(c.outputFormat.SampleRate)
+	}
 	time.Sleep(time.Duration(500) * time.Millisecond)
 	_ = c.SendTtsStop()
 
@@ -301,28 +274,19 @@ func (c *Client) Chat(ctx context.Context, text string) {
 	}
 }
 
-func (c *Client) streamTtsFile(text string, filename string) {
-	audioFile, err := os.Open(filename)
-	if err != nil {
-		c.logger.Error("os.Open", "filename", filename, "error", err)
-		return
-	}
+// streamTts plays one sentence, recording receives a copy of its PCM when not nil
+func (c *Client) streamTts(ctx context.Context, text string, stream *tts.Stream, recording *bytes.Buffer) {
+	defer stream.Close()
 
-	_ = c.SendTtsMessage("sentence_start", text)
-	decoder := wav.NewDecoder(audioFile)
-	duration, _ := decoder.Duration()
-	if _, err = audioFile.Seek(0, 0); err != nil {
-		c.logger.Error("audioFile.Seek", "error", err)
-		_ = audioFile.Close()
-		_ = os.Remove(filename)
-		return
+	var source io.Reader = stream
+	// history audio is stored as mono WAV
+	if recording != nil && stream.Channels == 1 {
+		source = io.TeeReader(stream, recording)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), duration+5*time.Second)
-	if err := audio.StreamOpus(ctx, audioFile, c.conn); err != nil {
-		c.logger.Error("audio.StreamOpus", "error", err)
+	_ = c.SendTtsMessage("sentence_start", text)
+	format := audio.PcmFormat{SampleRate: stream.SampleRate, Channels: stream.Channels}
+	if err := audio.StreamPcmOpus(ctx, source, format, c.outputFormat, c.conn); err != nil && ctx.Err() == nil {
+		c.logger.Error("audio.StreamPcmOpus", "error", err)
 	}
-	cancel()
-	_ = audioFile.Close()
-	_ = os.Remove(filename)
 }
@@ -21,6 +21,7 @@ import (
 	"github.com/phamviet/xiaozhi-hub/internal/hub/ws/types"
 	"github.com/phamviet/xiaozhi-hub/internal/mcp"
 	"github.com/phamviet/xiaozhi-hub/internal/tts"
+	xtypes "github.com/phamviet/xiaozhi-hub/xiaozhi/types"
 )
 
 // Client represents a connected agent/device
@@ -28,19 +29,20 @@ type Client struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	mu         sync.RWMutex
-	conn       *gws.Conn
-	g          *genkit.Genkit
-	tools      []ai.ToolRef
-	chatFlow   *core.Flow[string, string, struct{}]
-	ttsFlow    *core.Flow[string, *tts.Output, struct{}]
-	asr        *asr.Asr
-	agentStore session.Store[ChatState]
-	deviceID   string
-	sessionID  string
-	dispatcher *Dispatcher
-	services   *services.ServiceContainer
-	logger     *slog.Logger
+	mu          sync.RWMutex
+	conn        Conn
+	g           *genkit.Genkit
+	tools       []ai.ToolRef
+	chatFlow    *core.Flow[string, string, string]
+	asr         *asr.Asr
+	synthesizer tts.Synthesizer
+	agentStore  session.Store[ChatState]
+	agent       *xtypes.AIAgent
+	deviceID    string
+	sessionID   string
+	dispatcher  *Dispatcher
+	services    *services.ServiceContainer
+	logger      *slog.Logger
 
 	mcpClient *gomcp.Client
 
@@ -56,9 +58,24 @@ type Client struct {
 	mcpClientSession *gomcp.ClientSession
 
 	startTime        time.Time
-	sampleRate       int
+	outputFormat     audio.Format
 	exitIntentCalled bool
 
+	historyMu sync.Mutex
+	history   []*ai.Message
+
+	listenMode string
+	turnRun    sync.Mutex
+	turnMu     sync.Mutex
+	turnCancel context.CancelFunc
+
+	// device MCP tools by their name on the device, the current catalogue and every tool defined in genkit
+	deviceMCP         bool
+	deviceTools       map[string]*gomcp.Tool
+	deviceToolRefs    map[string]ai.Tool
+	deviceToolTimeout time.Duration
+	iot               iotThings
+
 	listenChan chan string
 	readyCh    chan struct{}
 	workChan   chan func()
@@ -66,29 +83,49 @@ type Client struct {
 }
 
 // Ensure Client implements handlers.Context
-var _ handlers.Context = (*Client)(nil)
+var (
+	_ handlers.Context    = (*Client)(nil)
+	_ handlers.IoTContext = (*Client)(nil)
+)
 
 // NewClient creates a new client instance
-func NewClient(conn *gws.Conn, deviceID string, sessionID string, services *services.ServiceContainer, logger *slog.Logger) *Client {
-	ctx, cancel := context.WithCancel(context.Background())
-	stt, err := asr.NewAsr(asr.WithLogger(logger))
+func NewClient(conn Conn, deviceID string, sessionID string, services *services.ServiceContainer, logger *slog.Logger) (*Client, error) {
+	agent, err := services.Agent.GetDeviceAgent(deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load device agent: %w", err)
+	}
+
+	stt, err := newSpeechToText(services, agent)
+	if err != nil {
+		return nil, err
+	}
+
+	synthesizer, err := newSynthesizer(services, agent)
+	if err != nil {
+		return nil, err
+	}
+
+	recognizer, err := asr.NewAsr(asr.WithLogger(logger), asr.WithSpeechToText(stt))
 	if err != nil {
-		logger.Error("Failed to create ASR instance: %v", err)
+		return nil, fmt.Errorf("failed to create ASR instance: %w", err)
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	c := &Client{
 		ctx:        ctx,
 		cancel:     cancel,
 		conn:       conn,
+		agent:      agent,
 		deviceID:   deviceID,
 		sessionID:  sessionID,
 		dispatcher: dispatcher,
 		services:   services,
 		logger:     logger,
 
-		asr:        stt,
-		sampleRate: audio.DefaultSampleRate,
-		agentStore: session.NewInMemoryStore[ChatState](),
+		asr:          recognizer,
+		synthesizer:  synthesizer,
+		outputFormat: audio.DefaultFormat,
+		agentStore:   session.NewInMemoryStore[ChatState](),
 
 		// Client default values
 		ClientVersion:         1,
@@ -112,8 +149,10 @@ func NewClient(conn *gws.Conn, deviceID string, sessionID string, services *serv
 	go c.processListenChan()
 
 	go c.processAsrResults()
+	go c.processAsrPartials()
+	go c.processSpeechStarts()
 
-	return c
+	return c, nil
 }
 
 func (c *Client) SendJSON(v interface{}) error {
@@ -153,9 +192,10 @@ func (c *Client) SetDeadline(t time.Time) error {
 	return c.conn.SetDeadline(t)
 }
 
-func (c *Client) OnTextMessage(message *gws.Message) {
-	msgBytes := make([]byte, len(message.Bytes()))
-	copy(msgBytes, message.Bytes())
+// OnTextMessage processes a JSON message, data is copied as transports reuse their buffers
+func (c *Client) OnTextMessage(data []byte) {
+	msgBytes := make([]byte, len(data))
+	copy(msgBytes, data)
 	if err := c.handleTextMessage(msgBytes); err != nil {
 		c.logger.Error("handle message", "error", err)
 	}
@@ -183,8 +223,7 @@ func (c *Client) handleTextMessage(msg []byte) error {
 	}
 
 	if base.Type == types.MessageTypeAbort {
-		c.asr.Stop()
-		return nil
+		return c.handleAbortMessage(msg)
 	}
 
 	handler, err := c.dispatcher.GetHandler(base.Type)
@@ -198,12 +237,8 @@ func (c *Client) handleTextMessage(msg []byte) error {
 
 // OnBinaryMessage processes incoming audio data
 func (c *Client) OnBinaryMessage(data []byte) {
-	if c.ClientAudioFormat == "opus" {
-		_ = c.asr.Write(data)
-		return
-	}
-
-	c.logger.Warn("Not supported audio format")
+	// the ASR decodes the format negotiated in the hello, opus or pcm
+	_ = c.asr.Write(data)
 }
 
 func (c *Client) processAsrResults() {
@@ -211,23 +246,36 @@ func (c *Client) processAsrResults() {
 	case <-c.ctx.Done():
 		return
 	default:
-		for text := range c.asr.Result() {
+		for utterance := range c.asr.Result() {
+			text := utterance.Text
 			c.Logger().Info("ASR result", "text", text)
 			if text != "" {
+				c.saveUserMessage(utterance)
 
-				// Save user message to history
-				//if err := c.Services().History.SaveMessage(c.SessionID(), "user", result); err != nil {
-				//	c.Logger().Error("Failed to save message history", "error", err)
-				//}
-
-				// Send to chat for processing
-				c.asr.Stop()
+				// Send to chat for processing, realtime devices keep listening so they can interrupt
+				if !c.isRealtimeListening() {
+					c.asr.Stop()
+				}
 				c.listenChan <- text
 			}
 		}
 	}
 }
 
+// processAsrPartials shows what the user is saying on the device screen while they speak
+func (c *Client) processAsrPartials() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case text := <-c.asr.Partial():
+			if err := c.SendSttMessage(text); err != nil {
+				c.logger.Debug("failed to send partial transcript", "error", err)
+			}
+		}
+	}
+}
+
 func (c *Client) Close() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
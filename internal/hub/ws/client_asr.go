@@ -0,0 +1,27 @@
+package ws
+
+import (
+	"fmt"
+
+	"github.com/phamviet/xiaozhi-hub/internal/asr"
+	"github.com/phamviet/xiaozhi-hub/internal/hub/services"
+	xtypes "github.com/phamviet/xiaozhi-hub/xiaozhi/types"
+)
+
+// newSpeechToText builds the speech-to-text provider configured by the agent's `asr_model_id`
+func newSpeechToText(services *services.ServiceContainer, agent *xtypes.AIAgent) (asr.SpeechToText, error) {
+	modelConfig, err := services.Agent.GetModelConfig(agent.ASRModelID, "ASR")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ASR model config: %w", err)
+	}
+
+	stt, err := asr.NewSpeechToText(modelConfig.Type, asr.Config{
+		Params:   modelConfig.Param,
+		Language: agent.LangCode,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create speech-to-text %q: %w", modelConfig.ID, err)
+	}
+
+	return stt, nil
+}
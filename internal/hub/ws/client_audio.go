@@ -37,8 +37,20 @@ func (c *Client) SendTtsMessage(state string, text string) error {
 	})
 }
 
+// SendLlmMessage sends reply text, emotion makes the device display the matching face when not empty
+func (c *Client) SendLlmMessage(text string, emotion string) error {
+	return c.SendJSON(types.LLMMessage{
+		BaseMessage: types.BaseMessage{
+			Type:      types.MessageTypeLLM,
+			SessionID: c.SessionID(),
+		},
+		Text:    text,
+		Emotion: emotion,
+	})
+}
+
 func (c *Client) SendSttMessage(text string) error {
-	return c.SendJSON(types.TTSMessage{
+	return c.SendJSON(types.STTMessage{
 		BaseMessage: types.BaseMessage{
 			Type:      types.MessageTypeSTT,
 			SessionID: c.SessionID(),
@@ -0,0 +1,95 @@
+package ws
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+// The LLM context is bounded by message count and an estimated token budget,
+// override them with the `llm.history_max_messages` and `llm.history_max_tokens` sys params.
+// 0 disables a limit.
+const (
+	DefaultHistoryMaxMessages = 40
+	DefaultHistoryMaxTokens   = 8000
+)
+
+// ChatContext is the LLM conversation saved on the `ai_agent_chat` record,
+// so a device reconnecting within the resume window continues where it left off
+type ChatContext struct {
+	Messages []*ai.Message `json:"messages"`
+}
+
+// loadChatContext restores the conversation of a resumed session
+func (c *Client) loadChatContext() {
+	var chatContext ChatContext
+	if err := c.services.Session.LoadContext(c.SessionID(), &chatContext); err != nil {
+		c.logger.Warn("Failed to load chat context", "error", err)
+		return
+	}
+
+	c.historyMu.Lock()
+	c.history = chatContext.Messages
+	c.historyMu.Unlock()
+
+	if len(chatContext.Messages) > 0 {
+		c.logger.Info("Resumed chat context", "messages", len(chatContext.Messages))
+	}
+}
+
+func (c *Client) chatHistory() []*ai.Message {
+	c.historyMu.Lock()
+	defer c.historyMu.Unlock()
+	return slices.Clone(c.history)
+}
+
+// updateChatHistory keeps the conversation of the last generate call, including tool
+// requests and responses, within the budget of cfg and persists it
+func (c *Client) updateChatHistory(messages []*ai.Message, cfg *AgentConfig) {
+	// the system prompt is rebuilt from the agent on every turn
+	messages = slices.DeleteFunc(slices.Clone(messages), func(m *ai.Message) bool {
+		return m == nil || m.Role == ai.RoleSystem
+	})
+	messages = trimHistory(messages, cfg.HistoryMaxMessages, cfg.HistoryMaxTokens)
+
+	c.historyMu.Lock()
+	c.history = messages
+	c.historyMu.Unlock()
+
+	if err := c.services.Session.SaveContext(c.SessionID(), ChatContext{Messages: messages}); err != nil {
+		c.logger.Error("Failed to save chat context", "error", err)
+	}
+}
+
+// trimHistory drops the oldest turns until the remaining messages fit the budget. It only cuts
+// before a user message, so a tool request is never separated from its response.
+func trimHistory(messages []*ai.Message, maxMessages, maxTokens int) []*ai.Message {
+	start := len(messages)
+	tokens := 0
+
+	for i := len(messages) - 1; i >= 0; i-- {
+		tokens += estimateTokens(messages[i])
+		if maxMessages > 0 && len(messages)-i > maxMessages {
+			break
+		}
+		if maxTokens > 0 && tokens > maxTokens {
+			break
+		}
+		if messages[i].Role == ai.RoleUser {
+			start = i
+		}
+	}
+
+	return messages[start:]
+}
+
+// estimateTokens approximates the token count with the common 4 bytes per token ratio
+func estimateTokens(message *ai.Message) int {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return 0
+	}
+
+	return len(data)/4 + 1
+}
@@ -0,0 +1,64 @@
+package ws
+
+import (
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+)
+
+func TestTrimHistory(t *testing.T) {
+	messages := []*ai.Message{
+		ai.NewUserTextMessage("first question"),
+		ai.NewModelTextMessage("first answer"),
+		ai.NewUserTextMessage("what time is it"),
+		ai.NewMessage(ai.RoleModel, nil, ai.NewToolRequestPart(&ai.ToolRequest{Name: "get_time"})),
+		ai.NewMessage(ai.RoleTool, nil, ai.NewToolResponsePart(&ai.ToolResponse{Name: "get_time", Output: "12:00"})),
+		ai.NewModelTextMessage("it is noon"),
+		ai.NewUserTextMessage("thanks"),
+		ai.NewModelTextMessage("you are welcome"),
+	}
+
+	tokens := func(from int) int {
+		sum := 0
+		for _, m := range messages[from:] {
+			sum += estimateTokens(m)
+		}
+		return sum
+	}
+
+	tests := []struct {
+		name        string
+		messages    []*ai.Message
+		maxMessages int
+		maxTokens   int
+		// want is the index of the first kept message
+		want int
+	}{
+		{"no limits", messages, 0, 0, 0},
+		{"within both", messages, 8, tokens(0), 0},
+		{"message cap", messages, 6, 0, 2},
+		{"token cap", messages, 0, tokens(2), 2},
+		{"token cap within a turn", messages, 0, tokens(2) - 1, 6},
+		{"cut inside tool call", messages, 5, 0, 6},
+		{"tool turn over message cap", messages[:6], 3, 0, 6},
+		{"single turn over token cap", messages[:2], 0, 1, 2},
+		{"messages disabled", messages, 0, tokens(6), 6},
+		{"tokens disabled", messages, 2, 0, 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := trimHistory(tt.messages, tt.maxMessages, tt.maxTokens)
+			want := tt.messages[min(tt.want, len(tt.messages)):]
+
+			if len(got) != len(want) {
+				t.Fatalf("trimHistory() kept %d messages, want %d", len(got), len(want))
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Fatalf("trimHistory() message %d = %+v, want %+v", i, got[i], want[i])
+				}
+			}
+		})
+	}
+}
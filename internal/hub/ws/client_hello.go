@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"log/slog"
 
+	"github.com/phamviet/xiaozhi-hub/internal/asr"
+	"github.com/phamviet/xiaozhi-hub/internal/audio"
 	"github.com/phamviet/xiaozhi-hub/internal/hub/ws/types"
 )
 
@@ -19,13 +21,30 @@ func (c *Client) handleHelloMessage(data []byte) error {
 	c.ClientSampleRate = helloMsg.AudioParams.SampleRate
 	c.ClientChannels = helloMsg.AudioParams.Channels
 	c.ClientFrameDuration = helloMsg.AudioParams.FrameDuration
+	c.deviceMCP = helloMsg.Features != nil && helloMsg.Features.MCP
 	c.mu.Unlock()
 
 	c.logger.Info("Client hello", slog.Any("message", helloMsg))
-	if c.ClientAudioFormat != "opus" {
-		c.logger.Warn("unsupported audio format", "audioFormat", helloMsg.AudioParams.Format)
+	if helloMsg.AudioParams.Format != "" {
+		if err := c.asr.SetInputFormat(asr.InputFormat{
+			Format:        helloMsg.AudioParams.Format,
+			SampleRate:    helloMsg.AudioParams.SampleRate,
+			Channels:      helloMsg.AudioParams.Channels,
+			FrameDuration: helloMsg.AudioParams.FrameDuration,
+		}); err != nil {
+			c.logger.Warn("unsupported audio params", "error", err, "audioFormat", helloMsg.AudioParams.Format)
+		}
 	}
 
+	output, err := negotiateOutputFormat(helloMsg.AudioParams)
+	if err != nil {
+		c.logger.Warn("unsupported output audio params, using default", "error", err)
+		output = audio.DefaultFormat
+	}
+	c.mu.Lock()
+	c.outputFormat = output
+	c.mu.Unlock()
+
 	response := types.HelloMessage{
 		BaseMessage: types.BaseMessage{
 			Type:      types.MessageTypeHello,
@@ -34,17 +53,52 @@ func (c *Client) handleHelloMessage(data []byte) error {
 		Transport: "websocket",
 		AudioParams: types.AudioParams{
 			Format:        "opus",
-			SampleRate:    16000,
-			Channels:      1,
-			FrameDuration: 60,
+			SampleRate:    output.SampleRate,
+			Channels:      audio.TargetChannels,
+			FrameDuration: output.FrameDuration,
 		},
 	}
 
+	if w, ok := c.conn.(HelloWriter); ok {
+		w.WriteHello(&response)
+	}
+
 	if err := c.SendJSON(response); err != nil {
 		return err
 	}
 
-	go c.initializeAgent(nil)
+	go c.initializeAgent(c.agentConfig())
 
 	return nil
 }
+
+// negotiateOutputFormat mirrors the device's own Opus sample rate and frame duration for the audio
+// sent back, boards with a 24 kHz codec then get 24 kHz TTS. Anything unset keeps the default.
+func negotiateOutputFormat(params types.AudioParams) (audio.Format, error) {
+	format := audio.DefaultFormat
+	if params.Format != "" && params.Format != "opus" {
+		// pcm uplink says nothing about what the decoder can play
+		return format, nil
+	}
+
+	if params.SampleRate > 0 {
+		format.SampleRate = params.SampleRate
+	}
+	if params.FrameDuration > 0 {
+		format.FrameDuration = params.FrameDuration
+	}
+
+	application, err := audio.ParseApplication(params.Application)
+	if err != nil {
+		return audio.DefaultFormat, err
+	}
+	format.Application = application
+	format.Bitrate = params.Bitrate
+	format.Complexity = params.Complexity
+
+	if err := format.Validate(); err != nil {
+		return audio.DefaultFormat, err
+	}
+
+	return format, nil
+}
@@ -0,0 +1,53 @@
+package ws
+
+import (
+	"bytes"
+
+	"github.com/phamviet/xiaozhi-hub/internal/asr"
+	"github.com/phamviet/xiaozhi-hub/internal/audio"
+	xtypes "github.com/phamviet/xiaozhi-hub/xiaozhi/types"
+)
+
+func (c *Client) historyEnabled() bool {
+	return c.agent != nil && c.agent.ChatHistoryEnabled
+}
+
+// saveUserMessage records a transcript, with the recognized speech attached when there is one
+func (c *Client) saveUserMessage(utterance asr.Utterance) {
+	if !c.historyEnabled() {
+		return
+	}
+
+	var wavAudio []byte
+	if len(utterance.Samples) > 0 {
+		var err error
+		if wavAudio, err = audio.Float32ToWavBytes(utterance.Samples, asr.SampleRate); err != nil {
+			c.logger.Warn("Failed to encode user audio", "error", err)
+		}
+	}
+
+	c.saveHistory(xtypes.TypeUser, utterance.Text, wavAudio)
+}
+
+// saveAssistantMessage records a reply together with the PCM that was played for it
+func (c *Client) saveAssistantMessage(content string, pcm *bytes.Buffer, sampleRate int) {
+	if !c.historyEnabled() || content == "" {
+		return
+	}
+
+	var wavAudio []byte
+	if pcm != nil && pcm.Len() > 0 && sampleRate > 0 {
+		var err error
+		if wavAudio, err = audio.PCMToWavBytes(pcm.Bytes(), sampleRate); err != nil {
+			c.logger.Warn("Failed to encode assistant audio", "error", err)
+		}
+	}
+
+	c.saveHistory(xtypes.ChatTypeAssistant, content, wavAudio)
+}
+
+func (c *Client) saveHistory(chatType xtypes.ChatType, content string, wavAudio []byte) {
+	if err := c.services.History.SaveMessage(c.SessionID(), c.DeviceID(), chatType, content, wavAudio); err != nil {
+		c.logger.Error("Failed to save message history", "error", err)
+	}
+}
@@ -0,0 +1,203 @@
+package ws
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/phamviet/xiaozhi-hub/internal/hub/ws/types"
+)
+
+// iotThings caches what older firmware announces through IoT descriptors instead of MCP
+type iotThings struct {
+	descriptors []types.IoTDescriptor
+	states      map[string]map[string]any // by thing name
+	tools       map[string]ai.Tool        // by genkit tool name
+}
+
+type iotMethod struct {
+	Description string                  `json:"description"`
+	Parameters  map[string]iotParameter `json:"parameters"`
+}
+
+type iotParameter struct {
+	Description string `json:"description"`
+	Type        string `json:"type"`
+}
+
+var invalidToolChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// maxToolNameLength is the longest function name LLM providers accept
+const maxToolNameLength = 64
+
+// SetIoTDescriptors records announced things, the firmware sends them one message at a time
+func (c *Client) SetIoTDescriptors(descriptors []types.IoTDescriptor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, d := range descriptors {
+		i := slices.IndexFunc(c.iot.descriptors, func(known types.IoTDescriptor) bool { return known.Name == d.Name })
+		if i >= 0 {
+			c.iot.descriptors[i] = d
+		} else {
+			c.iot.descriptors = append(c.iot.descriptors, d)
+		}
+	}
+}
+
+// SetIoTStates records the latest states, update only carries the things that changed
+func (c *Client) SetIoTStates(states []types.IoTState, update bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !update || c.iot.states == nil {
+		c.iot.states = make(map[string]map[string]any)
+	}
+
+	for _, s := range states {
+		if c.iot.states[s.Name] == nil {
+			c.iot.states[s.Name] = make(map[string]any)
+		}
+		for k, v := range s.State {
+			c.iot.states[s.Name][k] = v
+		}
+	}
+}
+
+// llmTools returns the tools of a turn, device tools and IoT things may change at any time of the session
+func (c *Client) llmTools() []ai.ToolRef {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.iot.tools == nil {
+		c.iot.tools = make(map[string]ai.Tool)
+	}
+
+	tools := append(slices.Clone(c.tools), c.deviceToolRefsLocked()...)
+	for _, d := range c.iot.descriptors {
+		methods, err := iotMethods(d)
+		if err != nil {
+			c.logger.Warn("invalid IoT descriptor", "thing", d.Name, "error", err)
+			continue
+		}
+
+		for methodName, method := range methods {
+			name := toolName("iot", d.Name, methodName)
+			tool, ok := c.iot.tools[name]
+			if !ok {
+				// genkit names are unique per session, a descriptor sent again keeps its first schema
+				tool = c.defineIoTTool(name, d, methodName, method)
+				c.iot.tools[name] = tool
+			}
+			tools = append(tools, tool)
+		}
+	}
+
+	return tools
+}
+
+func (c *Client) defineIoTTool(name string, d types.IoTDescriptor, method string, m iotMethod) ai.Tool {
+	description := strings.TrimSpace(d.Description + ": " + m.Description)
+
+	return genkit.DefineToolWithInputSchema(c.g, name, description, iotInputSchema(m),
+		func(ctx *ai.ToolContext, input any) (string, error) {
+			parameters, _ := input.(map[string]any)
+			if err := c.SendIoTCommand(d.Name, method, parameters); err != nil {
+				return "", err
+			}
+			return "ok", nil
+		},
+	)
+}
+
+// SendIoTCommand asks the device to run a method of one of its things
+func (c *Client) SendIoTCommand(thing, method string, parameters map[string]any) error {
+	if parameters == nil {
+		parameters = map[string]any{}
+	}
+
+	return c.SendJSON(types.IoTMessage{
+		BaseMessage: types.BaseMessage{
+			Type:      types.MessageTypeIoT,
+			SessionID: c.SessionID(),
+		},
+		Commands: []types.IoTCommand{{Name: thing, Method: method, Parameters: parameters}},
+	})
+}
+
+// iotStatePrompt tells the LLM the current state of the device things, so it answers without a tool call
+func (c *Client) iotStatePrompt() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.iot.states) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(c.iot.states))
+	for name := range c.iot.states {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("\n\nCurrent state of the device, answer questions about it from here:\n<device_state>\n")
+	for _, name := range names {
+		state, _ := json.Marshal(c.iot.states[name])
+		fmt.Fprintf(&b, "%s: %s\n", name, state)
+	}
+	b.WriteString("</device_state>")
+
+	return b.String()
+}
+
+func iotMethods(d types.IoTDescriptor) (map[string]iotMethod, error) {
+	raw, err := json.Marshal(d.Methods)
+	if err != nil {
+		return nil, err
+	}
+
+	var methods map[string]iotMethod
+	if err := json.Unmarshal(raw, &methods); err != nil {
+		return nil, err
+	}
+
+	return methods, nil
+}
+
+func iotInputSchema(m iotMethod) map[string]any {
+	properties := make(map[string]any, len(m.Parameters))
+	required := make([]string, 0, len(m.Parameters))
+	for name, p := range m.Parameters {
+		// the firmware only has integers, booleans and strings
+		kind := p.Type
+		switch kind {
+		case "number":
+			kind = "integer"
+		case "boolean", "string":
+		default:
+			kind = "string"
+		}
+
+		properties[name] = map[string]any{"type": kind, "description": p.Description}
+		required = append(required, name)
+	}
+	sort.Strings(required)
+
+	return map[string]any{"type": "object", "properties": properties, "required": required}
+}
+
+// toolName joins the parts into a name LLM providers accept
+func toolName(parts ...string) string {
+	name := invalidToolChars.ReplaceAllString(strings.Join(parts, "_"), "_")
+	if len(name) > maxToolNameLength {
+		name = name[:maxToolNameLength]
+	}
+
+	return name
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"time"
 
+	"github.com/phamviet/xiaozhi-hub/internal/asr"
 	"github.com/phamviet/xiaozhi-hub/internal/hub/ws/types"
 )
 
@@ -16,7 +17,13 @@ func (c *Client) handleListenMessage(msg []byte) error {
 
 	c.Logger().Info("Listen state change", "state", listenMsg.State, "mode", listenMsg.Mode)
 
-	if listenMsg.Mode == "auto" {
+	if listenMsg.Mode != "" {
+		c.mu.Lock()
+		c.listenMode = listenMsg.Mode
+		c.mu.Unlock()
+	}
+
+	if listenMsg.Mode == "auto" || listenMsg.Mode == ListenModeRealtime {
 		if listenMsg.State == "start" {
 			c.asr.Start()
 			c.logger.Debug("Start audio streaming from client")
@@ -27,10 +34,7 @@ func (c *Client) handleListenMessage(msg []byte) error {
 	if listenMsg.Text != "" {
 		c.Logger().Info("Wake word detected", "text", listenMsg.Text)
 
-		// Save user message to history
-		//if err := c.Services().History.SaveMessage(c.SessionID(), "user", listenMsg.Text); err != nil {
-		//	c.Logger().Error("Failed to save message history", "error", err)
-		//}
+		c.saveUserMessage(asr.Utterance{Text: listenMsg.Text})
 		c.listenChan <- listenMsg.Text
 		//c.Chat(listenMsg.Text)
 	}
@@ -54,7 +58,7 @@ func (c *Client) processListenChan() {
 
 		go func() {
 			defer close(done)
-			c.Chat(ctx, text)
+			c.runTurn(ctx, text)
 		}()
 
 		select {
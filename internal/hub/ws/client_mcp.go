@@ -1,11 +1,39 @@
 package ws
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
 
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/phamviet/xiaozhi-hub/internal/hub/services"
 	"github.com/phamviet/xiaozhi-hub/internal/hub/ws/types"
 )
 
+// defaultDeviceToolTimeout bounds a device tool call unless `mcp.tool_timeout` is set, a hung device
+// must not hold the turn until the listen timeout
+const defaultDeviceToolTimeout = 15 * time.Second
+
+// toolFailure is returned to the LLM instead of an error, an error would abort the whole answer
+type toolFailure struct {
+	Error     string `json:"error"`
+	Retryable bool   `json:"retryable"`
+}
+
+func newToolFailure(err error) toolFailure {
+	return toolFailure{
+		Error:     err.Error(),
+		Retryable: errors.Is(err, context.DeadlineExceeded),
+	}
+}
+
 func (c *Client) handleMcpMessage(msg []byte) error {
 	var mcpMsg types.MCPMessage
 	if err := json.Unmarshal(msg, &mcpMsg); err != nil {
@@ -14,3 +42,163 @@ func (c *Client) handleMcpMessage(msg []byte) error {
 
 	return c.mcpTransport.Receive(mcpMsg.Payload)
 }
+
+// connectDeviceTools opens the MCP session with the device server, its tools are listed again
+// whenever the device announces a change
+func (c *Client) connectDeviceTools() {
+	c.mu.RLock()
+	supported := c.deviceMCP
+	c.mu.RUnlock()
+	if !supported {
+		return
+	}
+
+	c.deviceToolTimeout = defaultDeviceToolTimeout
+	if n, err := strconv.Atoi(c.services.Agent.GetSysParam("mcp.tool_timeout")); err == nil && n > 0 {
+		c.deviceToolTimeout = time.Duration(n) * time.Second
+	}
+
+	c.mcpClient = gomcp.NewClient(&gomcp.Implementation{Name: mcpClientName}, c.deviceMCPOptions())
+
+	ctx, cancel := context.WithTimeout(c.ctx, mcpConnectTimeout)
+	defer cancel()
+
+	session, err := c.mcpClient.Connect(ctx, c.mcpTransport, nil)
+	if err != nil {
+		c.logger.Error("Failed to connect device MCP server", "error", err)
+		return
+	}
+	context.AfterFunc(c.ctx, func() { _ = session.Close() })
+
+	c.mu.Lock()
+	c.mcpClientSession = session
+	c.mu.Unlock()
+
+	if result := session.InitializeResult(); result != nil && result.Capabilities != nil && result.Capabilities.Logging != nil {
+		if err := session.SetLoggingLevel(ctx, &gomcp.SetLoggingLevelParams{Level: "info"}); err != nil {
+			c.logger.Debug("Failed to set device MCP log level", "error", err)
+		}
+	}
+
+	c.refreshDeviceTools()
+}
+
+// refreshDeviceTools lists the device tools, defines the new ones and records the catalogue
+func (c *Client) refreshDeviceTools() {
+	c.mu.RLock()
+	session := c.mcpClientSession
+	c.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(c.ctx, mcpConnectTimeout)
+	defer cancel()
+
+	var tools []*gomcp.Tool
+	for tool, err := range session.Tools(ctx, nil) {
+		if err != nil {
+			c.logger.Error("Failed to list device tools", "error", err)
+			return
+		}
+		tools = append(tools, tool)
+	}
+
+	deviceTools := make(map[string]*gomcp.Tool, len(tools))
+	catalogue := make([]services.DeviceTool, 0, len(tools))
+	for _, tool := range tools {
+		deviceTools[tool.Name] = tool
+		catalogue = append(catalogue, services.DeviceTool{Name: tool.Name, Description: tool.Description, InputSchema: tool.InputSchema})
+	}
+
+	c.mu.Lock()
+	if c.deviceToolRefs == nil {
+		c.deviceToolRefs = make(map[string]ai.Tool)
+	}
+	for _, tool := range tools {
+		// genkit cannot forget a tool, a removed one is only left out of the next turns
+		if _, ok := c.deviceToolRefs[tool.Name]; !ok {
+			c.deviceToolRefs[tool.Name] = c.defineDeviceTool(tool)
+		}
+	}
+	c.deviceTools = deviceTools
+	c.mu.Unlock()
+
+	c.logger.Info("Found device MCP tools", "count", len(tools))
+	if err := c.services.Device.SaveTools(c.deviceID, catalogue); err != nil {
+		c.logger.Warn("Failed to save device tools", "error", err)
+	}
+}
+
+func (c *Client) defineDeviceTool(tool *gomcp.Tool) ai.Tool {
+	return genkit.DefineToolWithInputSchema(c.g, mcpClientName+"_"+tool.Name, tool.Description, toolInputSchema(tool),
+		func(ctx *ai.ToolContext, input any) (any, error) {
+			arguments, _ := input.(map[string]any)
+			result, err := c.callDeviceTool(ctx, tool.Name, arguments)
+			if err != nil {
+				c.logger.Warn("Device tool failed", "tool", tool.Name, "error", err)
+				return newToolFailure(err), nil
+			}
+			return result, nil
+		},
+	)
+}
+
+// callDeviceTool runs a tool of the device MCP server within the per-call deadline
+func (c *Client) callDeviceTool(ctx context.Context, name string, arguments map[string]any) (any, error) {
+	c.mu.RLock()
+	session := c.mcpClientSession
+	_, ok := c.deviceTools[name]
+	c.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownDeviceTool, name)
+	}
+
+	if arguments == nil {
+		arguments = map[string]any{}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.deviceToolTimeout)
+	defer cancel()
+
+	result, err := session.CallTool(ctx, &gomcp.CallToolParams{Name: name, Arguments: arguments})
+	if err != nil {
+		return nil, err
+	}
+
+	return mcpToolOutput(result)
+}
+
+// deviceToolRefsLocked returns the genkit tools of the current device catalogue, c.mu must be held
+func (c *Client) deviceToolRefsLocked() []ai.ToolRef {
+	names := slices.Sorted(maps.Keys(c.deviceTools))
+	refs := make([]ai.ToolRef, 0, len(names))
+	for _, name := range names {
+		refs = append(refs, c.deviceToolRefs[name])
+	}
+
+	return refs
+}
+
+func toolInputSchema(tool *gomcp.Tool) map[string]any {
+	schema := map[string]any{"type": "object"}
+	if tool.InputSchema == nil {
+		return schema
+	}
+	if raw, err := json.Marshal(tool.InputSchema); err == nil {
+		_ = json.Unmarshal(raw, &schema)
+	}
+
+	return schema
+}
+
+// DeviceTools returns the current tool catalogue of the device MCP server, sorted by name
+func (c *Client) DeviceTools() []*gomcp.Tool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	names := slices.Sorted(maps.Keys(c.deviceTools))
+	tools := make([]*gomcp.Tool, len(names))
+	for i, name := range names {
+		tools[i] = c.deviceTools[name]
+	}
+
+	return tools
+}
@@ -0,0 +1,103 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// mcpLogLevels maps the syslog levels of MCP logging to slog
+var mcpLogLevels = map[gomcp.LoggingLevel]slog.Level{
+	"debug":     slog.LevelDebug,
+	"info":      slog.LevelInfo,
+	"notice":    slog.LevelInfo,
+	"warning":   slog.LevelWarn,
+	"error":     slog.LevelError,
+	"critical":  slog.LevelError,
+	"alert":     slog.LevelError,
+	"emergency": slog.LevelError,
+}
+
+var errUnsupportedSamplingContent = errors.New("only text sampling messages are supported")
+
+// deviceMCPOptions answers what the device MCP server may ask of the hub: sampling with the agent LLM,
+// logs into the hub logs and progress shown on the device screen
+func (c *Client) deviceMCPOptions() *gomcp.ClientOptions {
+	return &gomcp.ClientOptions{
+		CreateMessageHandler: c.handleSampling,
+		LoggingMessageHandler: func(ctx context.Context, req *gomcp.LoggingMessageRequest) {
+			c.handleMcpLog(ctx, req.Params)
+		},
+		ProgressNotificationHandler: func(ctx context.Context, req *gomcp.ProgressNotificationClientRequest) {
+			c.handleMcpProgress(req.Params)
+		},
+		ToolListChangedHandler: func(ctx context.Context, req *gomcp.ToolListChangedRequest) {
+			// not from the handler, the listing needs the session to keep reading
+			go c.refreshDeviceTools()
+		},
+	}
+}
+
+// handleSampling runs a sampling/createMessage request on the agent LLM
+func (c *Client) handleSampling(ctx context.Context, req *gomcp.CreateMessageRequest) (*gomcp.CreateMessageResult, error) {
+	messages := make([]*ai.Message, 0, len(req.Params.Messages))
+	for _, m := range req.Params.Messages {
+		text, ok := m.Content.(*gomcp.TextContent)
+		if !ok {
+			return nil, errUnsupportedSamplingContent
+		}
+
+		role := ai.RoleUser
+		if m.Role == "assistant" {
+			role = ai.RoleModel
+		}
+		messages = append(messages, ai.NewTextMessage(role, text.Text))
+	}
+
+	cfg := c.agentConfig()
+	system := req.Params.SystemPrompt
+	if system == "" {
+		system = cfg.SystemPrompt
+	}
+
+	resp, err := genkit.Generate(ctx, c.g, ai.WithSystem(system), ai.WithMessages(messages...))
+	if err != nil {
+		return nil, fmt.Errorf("sampling failed: %w", err)
+	}
+
+	return &gomcp.CreateMessageResult{
+		Content:    &gomcp.TextContent{Text: resp.Text()},
+		Model:      cfg.LLMModel,
+		Role:       "assistant",
+		StopReason: "endTurn",
+	}, nil
+}
+
+// handleMcpLog forwards a device log, the client logger is already tagged with the device and session
+func (c *Client) handleMcpLog(ctx context.Context, params *gomcp.LoggingMessageParams) {
+	level, ok := mcpLogLevels[params.Level]
+	if !ok {
+		level = slog.LevelInfo
+	}
+
+	c.logger.Log(ctx, level, "device mcp log", "source", params.Logger, "data", params.Data)
+}
+
+// handleMcpProgress shows the progress of a long running tool on the device screen
+func (c *Client) handleMcpProgress(params *gomcp.ProgressNotificationParams) {
+	text := params.Message
+	if params.Total > 0 {
+		text = fmt.Sprintf("%s %.0f%%", text, params.Progress*100/params.Total)
+	}
+	if text == "" {
+		return
+	}
+
+	_ = c.SendLlmMessage("", "thinking")
+	_ = c.SendTtsMessage("sentence_start", text)
+}
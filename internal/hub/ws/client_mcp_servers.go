@@ -0,0 +1,177 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	gomcp "github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/phamviet/xiaozhi-hub/internal/hub/services"
+)
+
+// mcpConnectTimeout bounds the connection and tool listing of one external MCP server
+const mcpConnectTimeout = 10 * time.Second
+
+// connectMCPServers merges the tools of the agent's external MCP servers, prefixed with the server name.
+// A server that cannot be reached is skipped, the conversation works without it.
+func (c *Client) connectMCPServers() []ai.ToolRef {
+	if c.agent == nil {
+		return nil
+	}
+
+	servers, err := c.services.Agent.GetMCPServers(c.agent.ID)
+	if err != nil {
+		c.logger.Error("Failed to load MCP servers", "error", err)
+		return nil
+	}
+
+	results := make([][]*gomcp.Tool, len(servers))
+	sessions := make([]*gomcp.ClientSession, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			session, tools, err := c.connectMCPServer(server)
+			if err != nil {
+				c.logger.Warn("Failed to connect MCP server", "server", server.Name, "error", err)
+				return
+			}
+			sessions[i], results[i] = session, tools
+		}()
+	}
+	wg.Wait()
+
+	taken := make(map[string]bool, len(c.tools))
+	for _, tool := range c.tools {
+		taken[tool.Name()] = true
+	}
+
+	var refs []ai.ToolRef
+	for i, server := range servers {
+		if sessions[i] == nil {
+			continue
+		}
+
+		for _, tool := range results[i] {
+			if slices.Contains(server.DisabledTools, tool.Name) {
+				continue
+			}
+
+			name := toolName(server.Name, tool.Name)
+			if taken[name] {
+				c.logger.Warn("MCP tool name is taken, skipping", "server", server.Name, "tool", tool.Name)
+				continue
+			}
+
+			taken[name] = true
+			refs = append(refs, c.defineMCPServerTool(name, sessions[i], server, tool))
+		}
+		c.logger.Info("Connected MCP server", "server", server.Name, "tools", len(results[i]))
+	}
+
+	return refs
+}
+
+func (c *Client) connectMCPServer(server services.MCPServer) (*gomcp.ClientSession, []*gomcp.Tool, error) {
+	var transport gomcp.Transport
+	switch server.Transport {
+	case services.MCPTransportStdio:
+		cmd := exec.Command(server.Command, server.Args...)
+		cmd.Env = append(os.Environ(), server.Env...)
+		transport = &gomcp.CommandTransport{Command: cmd}
+	case services.MCPTransportHTTP:
+		transport = &gomcp.StreamableClientTransport{
+			Endpoint:   server.URL,
+			HTTPClient: &http.Client{Transport: headerTransport{headers: server.Headers}},
+		}
+	default:
+		return nil, nil, fmt.Errorf("unknown transport %q", server.Transport)
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, mcpConnectTimeout)
+	defer cancel()
+
+	client := gomcp.NewClient(&gomcp.Implementation{Name: mcpClientName}, nil)
+	session, err := client.Connect(ctx, transport, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tools []*gomcp.Tool
+	for tool, err := range session.Tools(ctx, nil) {
+		if err != nil {
+			_ = session.Close()
+			return nil, nil, fmt.Errorf("failed to list tools: %w", err)
+		}
+		tools = append(tools, tool)
+	}
+
+	// the session lives as long as the device connection
+	context.AfterFunc(c.ctx, func() { _ = session.Close() })
+
+	return session, tools, nil
+}
+
+func (c *Client) defineMCPServerTool(name string, session *gomcp.ClientSession, server services.MCPServer, tool *gomcp.Tool) ai.Tool {
+	return genkit.DefineToolWithInputSchema(c.g, name, tool.Description, toolInputSchema(tool),
+		func(ctx *ai.ToolContext, input any) (any, error) {
+			callCtx, cancel := context.WithTimeout(ctx, server.Timeout)
+			defer cancel()
+
+			result, err := session.CallTool(callCtx, &gomcp.CallToolParams{Name: tool.Name, Arguments: input})
+			if err == nil {
+				var output any
+				if output, err = mcpToolOutput(result); err == nil {
+					return output, nil
+				}
+			}
+
+			c.logger.Warn("MCP server tool failed", "server", server.Name, "tool", tool.Name, "error", err)
+			return newToolFailure(fmt.Errorf("mcp server %s: %w", server.Name, err)), nil
+		},
+	)
+}
+
+// mcpToolOutput prefers the structured result, the text content otherwise
+func mcpToolOutput(result *gomcp.CallToolResult) (any, error) {
+	var texts []string
+	for _, content := range result.Content {
+		if text, ok := content.(*gomcp.TextContent); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+
+	if result.IsError {
+		return nil, errors.New(strings.Join(texts, "\n"))
+	}
+	if result.StructuredContent != nil {
+		return result.StructuredContent, nil
+	}
+
+	return strings.Join(texts, "\n"), nil
+}
+
+// headerTransport adds the configured headers, e.g. the credential, to every MCP request
+type headerTransport struct {
+	headers map[string]string
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	return http.DefaultTransport.RoundTrip(req)
+}
@@ -0,0 +1,142 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/phamviet/xiaozhi-hub/internal/emotion"
+	"github.com/phamviet/xiaozhi-hub/internal/hub/ws/types"
+	"github.com/phamviet/xiaozhi-hub/internal/sentence"
+)
+
+// SystemCommands are the `system` message commands the firmware understands
+var SystemCommands = []string{"reboot"}
+
+var (
+	ErrClientNotReady       = errors.New("device session is not ready")
+	ErrUnknownSystemCommand = errors.New("unknown system command")
+	ErrUnknownDeviceTool    = errors.New("device has no such tool")
+)
+
+// readyTimeout bounds how long a push waits for a device that just connected
+const readyTimeout = 10 * time.Second
+
+// waitReady waits for the hello and the agent set up, a push before that would use the wrong audio format
+func (c *Client) waitReady(ctx context.Context) error {
+	timer := time.NewTimer(readyTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-c.readyCh:
+		return nil
+	case <-c.ctx.Done():
+		return ErrClientNotReady
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return ErrClientNotReady
+	}
+}
+
+// Announce speaks text on the device, interrupting the current answer. It returns once played.
+func (c *Client) Announce(ctx context.Context, text string) error {
+	if err := c.waitReady(ctx); err != nil {
+		return err
+	}
+
+	// stop with the session, whoever asked for the announcement
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(c.ctx, cancel)
+	defer stop()
+
+	c.abortTurn("announcement")
+	c.runExclusive(ctx, func(ctx context.Context) {
+		c.speak(ctx, text)
+	})
+
+	return ctx.Err()
+}
+
+// Remind announces a reminder, generate lets the agent phrase it in its own voice
+func (c *Client) Remind(ctx context.Context, text string, generate bool) error {
+	if err := c.waitReady(ctx); err != nil {
+		return err
+	}
+
+	if generate {
+		prompt := "Tell the user about this reminder in one or two short sentences: " + text
+		generated, err := genkit.GenerateText(ctx, c.g, ai.WithSystem(c.agentConfig().SystemPrompt), ai.WithPrompt(prompt))
+		if err != nil {
+			return fmt.Errorf("failed to generate reminder: %w", err)
+		}
+		text = generated
+	}
+
+	return c.Announce(ctx, text)
+}
+
+// speak plays a fixed text like an answer, with the display text and the emotion of each sentence
+func (c *Client) speak(ctx context.Context, text string) {
+	speaker := c.newSpeaker(ctx)
+	for _, s := range sentence.Split(text) {
+		feeling, _ := emotion.Detect(s)
+		_ = c.SendLlmMessage(s, feeling)
+
+		if s = emotion.Strip(s); s != "" {
+			speaker.Say(s)
+		}
+	}
+	speaker.Close()
+	c.saveAssistantMessage(text, speaker.recording, speaker.recordingRate)
+
+	if ctx.Err() != nil {
+		if speaker.started {
+			_ = c.SendTtsStop()
+		}
+		return
+	}
+
+	if !speaker.started {
+		_ = c.SendTtsStart(c.outputFormat.SampleRate)
+	}
+	_ = c.SendTtsStop()
+}
+
+// SendSystemCommand asks the firmware to run one of SystemCommands
+func (c *Client) SendSystemCommand(command string) error {
+	if !slices.Contains(SystemCommands, command) {
+		return fmt.Errorf("%w: %q", ErrUnknownSystemCommand, command)
+	}
+
+	return c.SendJSON(types.SystemMessage{
+		BaseMessage: types.BaseMessage{
+			Type:      types.MessageTypeSystem,
+			SessionID: c.SessionID(),
+		},
+		Command: command,
+	})
+}
+
+// CallTool runs a tool of the device MCP server, name is the tool name on the device
+func (c *Client) CallTool(ctx context.Context, name string, arguments map[string]any) (any, error) {
+	if err := c.waitReady(ctx); err != nil {
+		return nil, err
+	}
+
+	return c.callDeviceTool(ctx, name, arguments)
+}
+
+// AgentID is the agent the device is bound to
+func (c *Client) AgentID() string {
+	if c.agent == nil {
+		return ""
+	}
+
+	return c.agent.ID
+}
@@ -1,12 +1,25 @@
 package ws
 
 import (
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/genkit"
+	"github.com/phamviet/xiaozhi-hub/internal/hub/services"
 )
 
+// reminderTimeLayout is the local time format of the `at` reminder input
+const reminderTimeLayout = "2006-01-02 15:04"
+
+type reminderInput struct {
+	Message      string `json:"message" jsonschema:"description=What to say to the user when the reminder fires"`
+	DelayMinutes int    `json:"delay_minutes,omitempty" jsonschema:"description=Fire once after this many minutes"`
+	At           string `json:"at,omitempty" jsonschema:"description=Fire once at this local time formatted as YYYY-MM-DD HH:MM"`
+	Schedule     string `json:"schedule,omitempty" jsonschema:"description=Repeat on this five field cron expression in local time"`
+}
+
 func (c *Client) initInternalTools() {
 	var tools []ai.ToolRef
 	exitTool := genkit.DefineTool(c.g, "exit_intent", "Use this when user want to stop the conversation",
@@ -17,6 +30,55 @@ func (c *Client) initInternalTools() {
 		},
 	)
 
-	tools = append(tools, exitTool)
+	reminderTool := genkit.DefineTool(c.g, "create_reminder",
+		"Use this when the user asks to be reminded of something later or on a schedule. Set exactly one of delay_minutes, at or schedule. "+
+			"Local time is in the "+c.services.Reminder.Location().String()+" timezone, the current local time is given in the system prompt.",
+		func(ctx *ai.ToolContext, input reminderInput) (string, error) {
+			return c.createReminder(input)
+		},
+	)
+
+	tools = append(tools, exitTool, reminderTool)
 	c.tools = tools
 }
+
+// timePrompt gives the LLM the local date and time, it cannot resolve "tomorrow at 8" otherwise
+func (c *Client) timePrompt() string {
+	now := time.Now().In(c.services.Reminder.Location())
+
+	return fmt.Sprintf("\n\nThe current local time is %s, a %s.", now.Format(time.RFC3339), now.Weekday())
+}
+
+// createReminder schedules a reminder for this device from the LLM tool input
+func (c *Client) createReminder(input reminderInput) (string, error) {
+	loc := c.services.Reminder.Location()
+	r := services.Reminder{
+		AgentID:  c.AgentID(),
+		DeviceID: c.deviceID,
+		Message:  input.Message,
+		Schedule: input.Schedule,
+		Timezone: loc.String(),
+		Source:   "llm",
+	}
+
+	switch {
+	case input.DelayMinutes > 0:
+		r.RunAt = time.Now().Add(time.Duration(input.DelayMinutes) * time.Minute)
+	case input.At != "":
+		at, err := time.ParseInLocation(reminderTimeLayout, input.At, loc)
+		if err != nil {
+			return "", fmt.Errorf("invalid time %q, expected YYYY-MM-DD HH:MM: %w", input.At, err)
+		}
+		r.RunAt = at
+	}
+
+	if _, err := c.services.Reminder.Create(r); err != nil {
+		return "", err
+	}
+
+	if r.Schedule != "" {
+		return "Reminder scheduled: " + r.Schedule, nil
+	}
+
+	return "Reminder set for " + r.RunAt.In(loc).Format(reminderTimeLayout), nil
+}
@@ -0,0 +1,28 @@
+package ws
+
+import (
+	"fmt"
+
+	"github.com/phamviet/xiaozhi-hub/internal/hub/services"
+	"github.com/phamviet/xiaozhi-hub/internal/tts"
+	xtypes "github.com/phamviet/xiaozhi-hub/xiaozhi/types"
+)
+
+// newSynthesizer builds the text-to-speech provider configured by the agent's `tts_model_id` and `tts_voice_id`
+func newSynthesizer(services *services.ServiceContainer, agent *xtypes.AIAgent) (tts.Synthesizer, error) {
+	modelConfig, err := services.Agent.GetModelConfig(agent.TTSModelID, "TTS")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TTS model config: %w", err)
+	}
+
+	synthesizer, err := tts.NewSynthesizer(modelConfig.Type, tts.Config{
+		Params:   modelConfig.Param,
+		Voice:    agent.TTSVoiceID,
+		Language: agent.LangCode,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create text-to-speech %q: %w", modelConfig.ID, err)
+	}
+
+	return synthesizer, nil
+}
@@ -0,0 +1,92 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/phamviet/xiaozhi-hub/internal/hub/ws/types"
+)
+
+// ListenModeRealtime devices keep streaming microphone audio while speaking (with AEC),
+// so the user can talk over the answer.
+const ListenModeRealtime = "realtime"
+
+// runTurn answers one user utterance, the turn can be interrupted with abortTurn
+func (c *Client) runTurn(parent context.Context, text string) {
+	c.runExclusive(parent, func(ctx context.Context) {
+		c.Chat(ctx, text)
+	})
+}
+
+// runExclusive runs fn as the current turn, one at a time so that answers and
+// announcements never play over each other
+func (c *Client) runExclusive(parent context.Context, fn func(ctx context.Context)) {
+	c.turnRun.Lock()
+	defer c.turnRun.Unlock()
+
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	c.turnMu.Lock()
+	c.turnCancel = cancel
+	c.turnMu.Unlock()
+
+	defer func() {
+		c.turnMu.Lock()
+		c.turnCancel = nil
+		c.turnMu.Unlock()
+	}()
+
+	fn(ctx)
+}
+
+// abortTurn cancels the LLM generation, pending TTS jobs and playback of the running turn.
+// It reports whether a turn was running.
+func (c *Client) abortTurn(reason string) bool {
+	c.turnMu.Lock()
+	cancel := c.turnCancel
+	c.turnCancel = nil
+	c.turnMu.Unlock()
+
+	if cancel == nil {
+		return false
+	}
+
+	c.logger.Info("Turn aborted", "reason", reason)
+	cancel()
+	return true
+}
+
+func (c *Client) handleAbortMessage(msg []byte) error {
+	var abortMsg types.AbortMessage
+	if err := json.Unmarshal(msg, &abortMsg); err != nil {
+		return err
+	}
+
+	if !c.abortTurn(abortMsg.Reason) {
+		// nothing is playing on our side, still let the device leave the speaking state
+		return c.SendTtsStop()
+	}
+
+	return nil
+}
+
+func (c *Client) isRealtimeListening() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.listenMode == ListenModeRealtime
+}
+
+// processSpeechStarts interrupts the answer as soon as the user starts talking over it
+func (c *Client) processSpeechStarts() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-c.asr.SpeechStarted():
+			if c.isRealtimeListening() {
+				c.abortTurn("speech")
+			}
+		}
+	}
+}
@@ -4,6 +4,12 @@ import (
 	"github.com/phamviet/xiaozhi-hub/internal/hub/ws/types"
 )
 
+// IoTContext is implemented by clients that keep the things a device announces
+type IoTContext interface {
+	SetIoTDescriptors(descriptors []types.IoTDescriptor)
+	SetIoTStates(states []types.IoTState, update bool)
+}
+
 type IoTHandler struct {
 	BaseHandler
 }
@@ -14,7 +20,18 @@ func (h *IoTHandler) Handle(ctx Context, msg []byte) error {
 		return err
 	}
 
-	//ctx.Logger().Debug("IoT message received", "update", iotMsg.Update)
+	things, ok := ctx.(IoTContext)
+	if !ok {
+		return nil
+	}
+
+	if len(iotMsg.Descriptors) > 0 {
+		ctx.Logger().Debug("IoT descriptors received", "count", len(iotMsg.Descriptors))
+		things.SetIoTDescriptors(iotMsg.Descriptors)
+	}
+	if len(iotMsg.States) > 0 {
+		things.SetIoTStates(iotMsg.States, iotMsg.Update)
+	}
 
 	return nil
 }
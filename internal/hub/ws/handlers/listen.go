@@ -16,15 +16,9 @@ func (h *ListenHandler) Handle(ctx Context, msg []byte) error {
 
 	ctx.Logger().Info("Listen state change", "state", listenMsg.State, "mode", listenMsg.Mode, "session_id", ctx.SessionID())
 
-	// If text is provided (wake word detected), we might want to trigger STT/LLM pipeline immediately
+	// Wake word text is answered and saved to history by the client pipeline
 	if listenMsg.Text != "" {
 		ctx.Logger().Info("Wake word detected", "text", listenMsg.Text)
-
-		// Save user message to history
-		if err := ctx.Services().History.SaveMessage(ctx.SessionID(), "user", listenMsg.Text); err != nil {
-			ctx.Logger().Error("Failed to save message history", "error", err)
-		}
-
 	}
 
 	return nil
@@ -0,0 +1,71 @@
+package ws
+
+import "sync"
+
+// Registry tracks the live clients of every transport, so the hub can reach a device
+// from outside its connection, e.g. to push an announcement
+type Registry struct {
+	mu      sync.RWMutex
+	clients map[string]*Client // by device id
+
+	onRegister func(c *Client)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{clients: make(map[string]*Client)}
+}
+
+// Register makes c the client of its device until c is closed, replacing an older one
+func (r *Registry) Register(c *Client) {
+	r.mu.Lock()
+	r.clients[c.deviceID] = c
+	onRegister := r.onRegister
+	r.mu.Unlock()
+
+	if onRegister != nil {
+		go onRegister(c)
+	}
+
+	go func() {
+		<-c.ctx.Done()
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.clients[c.deviceID] == c {
+			delete(r.clients, c.deviceID)
+		}
+	}()
+}
+
+// OnRegister sets fn to run in its own goroutine for every registered client,
+// e.g. to deliver what was queued while the device was offline
+func (r *Registry) OnRegister(fn func(c *Client)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.onRegister = fn
+}
+
+// Get returns the live client of a device
+func (r *Registry) Get(deviceID string) (*Client, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	c, ok := r.clients[deviceID]
+	return c, ok
+}
+
+// ByAgent returns the live clients of every device bound to an agent
+func (r *Registry) ByAgent(agentID string) []*Client {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var clients []*Client
+	for _, c := range r.clients {
+		if c.agent != nil && c.agent.ID == agentID {
+			clients = append(clients, c)
+		}
+	}
+
+	return clients
+}
@@ -0,0 +1,128 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/phamviet/xiaozhi-hub/internal/tts"
+)
+
+// maxPendingSentences bounds how far synthesis runs ahead of playback
+const maxPendingSentences = 3
+
+type sentenceJob struct {
+	text   string
+	result chan ttsResult
+}
+
+type ttsResult struct {
+	stream *tts.Stream
+	err    error
+}
+
+// speaker synthesizes sentences as soon as they are known and plays them in order,
+// so the first sentence is heard while the model is still generating the rest
+type speaker struct {
+	client *Client
+	ctx    context.Context
+
+	sentences chan string
+	jobs      chan *sentenceJob
+	slots     chan struct{}
+	done      chan struct{}
+
+	// only touched by the playback goroutine until done is closed
+	started       bool
+	recording     *bytes.Buffer
+	recordingRate int
+}
+
+func (c *Client) newSpeaker(ctx context.Context) *speaker {
+	s := &speaker{
+		client:    c,
+		ctx:       ctx,
+		sentences: make(chan string, 64),
+		jobs:      make(chan *sentenceJob, maxPendingSentences),
+		slots:     make(chan struct{}, maxPendingSentences),
+		done:      make(chan struct{}),
+	}
+
+	// keep what is played for the chat history
+	if c.historyEnabled() {
+		s.recording = &bytes.Buffer{}
+	}
+
+	go s.synthesize()
+	go s.play()
+
+	return s
+}
+
+// Say queues a sentence
+func (s *speaker) Say(text string) {
+	select {
+	case s.sentences <- text:
+	case <-s.ctx.Done():
+	}
+}
+
+// Close waits until every queued sentence has been played, or dropped after an abort
+func (s *speaker) Close() {
+	close(s.sentences)
+	<-s.done
+}
+
+func (s *speaker) synthesize() {
+	defer close(s.jobs)
+
+	for text := range s.sentences {
+		select {
+		case s.slots <- struct{}{}:
+		case <-s.ctx.Done():
+			continue
+		}
+
+		job := &sentenceJob{text: text, result: make(chan ttsResult, 1)}
+		go func() {
+			stream, err := tts.SynthesizeStream(s.ctx, s.client.synthesizer, job.text)
+			job.result <- ttsResult{stream: stream, err: err}
+		}()
+
+		s.jobs <- job
+	}
+}
+
+func (s *speaker) play() {
+	defer close(s.done)
+
+	for job := range s.jobs {
+		s.playJob(job)
+		<-s.slots
+	}
+}
+
+func (s *speaker) playJob(job *sentenceJob) {
+	res := <-job.result
+	if res.err != nil {
+		if s.ctx.Err() == nil {
+			s.client.logger.Error("tts.SynthesizeStream", "error", res.err, "text", job.text)
+		}
+		return
+	}
+
+	// release the connections of pending jobs after an abort
+	if s.ctx.Err() != nil {
+		_ = res.stream.Close()
+		return
+	}
+
+	if !s.started {
+		s.started = true
+		_ = s.client.SendTtsStart(s.client.outputFormat.SampleRate)
+	}
+	if s.recordingRate == 0 {
+		s.recordingRate = res.stream.SampleRate
+	}
+
+	s.client.streamTts(s.ctx, job.text, res.stream, s.recording)
+}
@@ -16,6 +16,8 @@ const (
 	MessageTypeMCP    MessageType = "mcp"
 	MessageTypeSystem MessageType = "system"
 	MessageTypeCustom MessageType = "custom"
+	// MessageTypeGoodbye ends an MQTT session, the device closes its UDP audio channel
+	MessageTypeGoodbye MessageType = "goodbye"
 )
 
 // BaseMessage contains common fields for routing
@@ -30,6 +32,10 @@ type AudioParams struct {
 	SampleRate    int    `json:"sample_rate"`
 	Channels      int    `json:"channels"`
 	FrameDuration int    `json:"frame_duration,omitempty"`
+	// Opus encoder preferences for the audio sent to the device, optional
+	Application string `json:"application,omitempty"`
+	Bitrate     int    `json:"bitrate,omitempty"`
+	Complexity  int    `json:"complexity,omitempty"`
 }
 
 // HelloMessage (Client -> Server & Server -> Client)
@@ -39,6 +45,15 @@ type HelloMessage struct {
 	Features    *Features   `json:"features,omitempty"`
 	Transport   string      `json:"transport,omitempty"`
 	AudioParams AudioParams `json:"audio_params"`
+	UDP         *UDPParams  `json:"udp,omitempty"`
+}
+
+// UDPParams tells an MQTT device where to send its encrypted audio
+type UDPParams struct {
+	Server string `json:"server"`
+	Port   int    `json:"port"`
+	Key    string `json:"key"`   // AES-128 key, hex
+	Nonce  string `json:"nonce"` // packet header template, hex
 }
 
 type Features struct {
@@ -59,12 +74,20 @@ type IoTState struct {
 	State map[string]interface{} `json:"state"`
 }
 
-// IoTMessage (Client -> Server)
+// IoTCommand calls a method of a thing
+type IoTCommand struct {
+	Name       string         `json:"name"`
+	Method     string         `json:"method"`
+	Parameters map[string]any `json:"parameters"`
+}
+
+// IoTMessage (Client -> Server: descriptors and states, Server -> Client: commands)
 type IoTMessage struct {
 	BaseMessage
-	Update      bool            `json:"update"`
+	Update      bool            `json:"update,omitempty"`
 	Descriptors []IoTDescriptor `json:"descriptors,omitempty"`
 	States      []IoTState      `json:"states,omitempty"`
+	Commands    []IoTCommand    `json:"commands,omitempty"`
 }
 
 // ListenMessage (Client -> Server)
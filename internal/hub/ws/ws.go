@@ -7,6 +7,7 @@ import (
 	"weak"
 
 	"github.com/lxzan/gws"
+	"github.com/phamviet/xiaozhi-hub/internal/hub/services"
 	"github.com/phamviet/xiaozhi-hub/internal/hub/ws/handlers"
 	"github.com/phamviet/xiaozhi-hub/internal/hub/ws/types"
 )
@@ -15,8 +16,24 @@ const (
 	ReadTimeout          = 30 * time.Second
 	PingInterval         = 5 * time.Second
 	HeartbeatWaitTimeout = 10 * time.Second
+	// ReconnectGrace is how long a device may be gone before it is reported offline
+	ReconnectGrace = 5 * time.Second
 )
 
+// Conn is the device side of a session: the WebSocket itself, or MQTT for JSON and UDP for audio
+type Conn interface {
+	SetDeadline(t time.Time) error
+	WriteMessage(opcode gws.Opcode, payload []byte) error
+	WriteClose(code uint16, reason []byte) error
+}
+
+// HelloWriter is implemented by transports that add their own fields to the server hello
+type HelloWriter interface {
+	WriteHello(msg *types.HelloMessage)
+}
+
+var _ Conn = (*gws.Conn)(nil)
+
 // Handler implements the WebSocket event handler for agent connections.
 type Handler struct {
 	gws.BuiltinEventHandler
@@ -28,7 +45,7 @@ type WsConn struct {
 	Client   *Client
 	DownChan chan struct{}
 
-	deviceID string
+	connectionID string
 }
 
 var (
@@ -90,7 +107,7 @@ func (h *Handler) OnMessage(conn *gws.Conn, message *gws.Message) {
 	client := wsConn.(*WsConn).Client
 
 	if message.Opcode == gws.OpcodeText {
-		client.OnTextMessage(message)
+		client.OnTextMessage(message.Bytes())
 		return
 	}
 
@@ -108,14 +125,24 @@ func (h *Handler) OnClose(conn *gws.Conn, err error) {
 	}
 	connWrapper := wsConn.(*WsConn)
 	connWrapper.conn = nil
-	if connWrapper.Client != nil {
-		connWrapper.Client.Close()
+	if client := connWrapper.Client; client != nil {
+		client.Close()
+
+		if connWrapper.connectionID != "" {
+			reason := "closed"
+			if err != nil {
+				reason = err.Error()
+			}
+			if err := client.Services().Device.Disconnected(connWrapper.connectionID, client.ProtocolVersion(), reason); err != nil {
+				client.Logger().Error("failed to record disconnection", "error", err)
+			}
+		}
 	}
 
 	// wait 5 seconds to allow reconnection before setting system down
 	// use a weak pointer to avoid keeping references if the system is removed
 	go func(downChan weak.Pointer[chan struct{}]) {
-		time.Sleep(5 * time.Second)
+		time.Sleep(ReconnectGrace)
 		downChanValue := downChan.Value()
 		if downChanValue != nil {
 			// Check if channel is closed or full before sending to avoid panic/blocking
@@ -127,6 +154,30 @@ func (h *Handler) OnClose(conn *gws.Conn, err error) {
 	}(weak.Make(&connWrapper.DownChan))
 }
 
+// TrackPresence records the connection as the device's current one, the device is
+// reported offline when DownChan fires, i.e. it did not reconnect within ReconnectGrace.
+func (ws *WsConn) TrackPresence(ip string) error {
+	client := ws.Client
+	connectionID, err := client.Services().Device.Connected(client.DeviceID(), services.ConnectionInfo{
+		SessionID: client.SessionID(),
+		Transport: services.TransportWebsocket,
+		IP:        ip,
+	})
+	if err != nil {
+		return err
+	}
+	ws.connectionID = connectionID
+
+	go func() {
+		<-ws.DownChan
+		if err := client.Services().Device.SetOffline(client.DeviceID(), connectionID); err != nil {
+			client.Logger().Error("failed to record device offline", "error", err)
+		}
+	}()
+
+	return nil
+}
+
 // Close terminates the WebSocket connection gracefully.
 func (ws *WsConn) Close(msg []byte) {
 	if ws.IsConnected() {
@@ -0,0 +1,153 @@
+// Package sentence cuts streamed LLM text into sentences that can be synthesized one by one.
+package sentence
+
+import (
+	"strings"
+	"unicode"
+)
+
+// DefaultSoftLimit is the length (in runes) after which a sentence is also cut on commas and colons,
+// so long run-on sentences do not delay the first audio.
+const DefaultSoftLimit = 60
+
+// Splitter buffers streamed text and returns complete sentences. ASCII punctuation only ends a
+// sentence when followed by a space, so decimals ("3.14"), versions and URLs are kept intact.
+// CJK punctuation ends a sentence right away.
+type Splitter struct {
+	buf       []rune
+	SoftLimit int
+}
+
+func NewSplitter() *Splitter {
+	return &Splitter{SoftLimit: DefaultSoftLimit}
+}
+
+// Push appends a chunk and returns the sentences it completed
+func (s *Splitter) Push(chunk string) []string {
+	s.buf = append(s.buf, []rune(chunk)...)
+
+	var sentences []string
+	for {
+		end := s.boundary()
+		if end < 0 {
+			return sentences
+		}
+
+		if sentence := clean(string(s.buf[:end])); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		s.buf = s.buf[end:]
+	}
+}
+
+// Flush returns whatever is left once the stream ended
+func (s *Splitter) Flush() string {
+	rest := clean(string(s.buf))
+	s.buf = nil
+	return rest
+}
+
+// Split cuts a complete text into sentences
+func Split(text string) []string {
+	s := NewSplitter()
+	sentences := s.Push(text)
+	if rest := s.Flush(); rest != "" {
+		sentences = append(sentences, rest)
+	}
+	return sentences
+}
+
+// boundary returns the index right after the first complete sentence, -1 when there is none yet
+func (s *Splitter) boundary() int {
+	for i := 0; i < len(s.buf); i++ {
+		r := s.buf[i]
+
+		switch {
+		case r == '\n':
+			return i + 1
+
+		case isFullWidthTerminal(r):
+			return skipClosers(s.buf, skipRun(s.buf, i+1, isTerminal))
+
+		case isTerminal(r):
+			end := skipClosers(s.buf, skipRun(s.buf, i+1, isTerminal))
+			if end == len(s.buf) {
+				// wait for the next chunk to tell "3." from "3.14"
+				return -1
+			}
+			if unicode.IsSpace(s.buf[end]) {
+				return end
+			}
+
+		case s.SoftLimit > 0 && i >= s.SoftLimit && isSoftBreak(r):
+			if isFullWidth(r) {
+				return i + 1
+			}
+			if i+1 == len(s.buf) {
+				return -1
+			}
+			if unicode.IsSpace(s.buf[i+1]) {
+				return i + 1
+			}
+		}
+	}
+
+	return -1
+}
+
+func skipRun(buf []rune, i int, match func(rune) bool) int {
+	for i < len(buf) && match(buf[i]) {
+		i++
+	}
+	return i
+}
+
+func skipClosers(buf []rune, i int) int {
+	return skipRun(buf, i, isCloser)
+}
+
+// isTerminal reports sentence ending punctuation, including full width forms
+func isTerminal(r rune) bool {
+	switch r {
+	case '.', '!', '?', ';', '…':
+		return true
+	}
+	return isFullWidthTerminal(r)
+}
+
+func isFullWidthTerminal(r rune) bool {
+	switch r {
+	case '。', '！', '？', '；', '｡':
+		return true
+	}
+	return false
+}
+
+func isSoftBreak(r rune) bool {
+	switch r {
+	case ',', ':', '，', '、', '：':
+		return true
+	}
+	return false
+}
+
+func isFullWidth(r rune) bool {
+	return r >= 0x3000 && r <= 0x303f || r >= 0xff00 && r <= 0xffef
+}
+
+func isCloser(r rune) bool {
+	switch r {
+	case '"', '\'', ')', ']', '}', '»', '”', '’', '」', '』', '）', '】', '》':
+		return true
+	}
+	return false
+}
+
+// clean trims a sentence and drops it when it has nothing to pronounce
+func clean(sentence string) string {
+	sentence = strings.TrimSpace(sentence)
+	if strings.IndexFunc(sentence, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }) < 0 {
+		return ""
+	}
+	return sentence
+}
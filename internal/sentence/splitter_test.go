@@ -0,0 +1,63 @@
+package sentence
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"english", "Hello there! How are you? I am fine.", []string{"Hello there!", "How are you?", "I am fine."}},
+		{"decimals", "Pi is 3.14 roughly. Version 1.2.3 is out.", []string{"Pi is 3.14 roughly.", "Version 1.2.3 is out."}},
+		{"ellipsis and quotes", `He said "wait..." and left. Then?!`, []string{`He said "wait..."`, "and left.", "Then?!"}},
+		{"chinese", "你好。今天天气怎么样？很好！", []string{"你好。", "今天天气怎么样？", "很好！"}},
+		{"vietnamese", "Xin chào! Hôm nay trời đẹp quá. Bạn khỏe không?", []string{"Xin chào!", "Hôm nay trời đẹp quá.", "Bạn khỏe không?"}},
+		{"newlines", "First line\n\nSecond line", []string{"First line", "Second line"}},
+		{"punctuation only", "Done. ... !", []string{"Done."}},
+		{"no punctuation", "no end in sight", []string{"no end in sight"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Split(tt.text); !slices.Equal(got, tt.want) {
+				t.Errorf("Split() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitterStreaming(t *testing.T) {
+	s := NewSplitter()
+	var got []string
+
+	// chunks cut in the middle of a decimal number and right after a period
+	for _, chunk := range []string{"It costs 3", ".", "50 dollars", ".", " Thanks", "。好的"} {
+		got = append(got, s.Push(chunk)...)
+	}
+
+	if want := []string{"It costs 3.50 dollars.", "Thanks。"}; !slices.Equal(got, want) {
+		t.Fatalf("Push() = %q, want %q", got, want)
+	}
+	if rest := s.Flush(); rest != "好的" {
+		t.Fatalf("Flush() = %q, want %q", rest, "好的")
+	}
+}
+
+func TestSplitterSoftLimit(t *testing.T) {
+	s := NewSplitter()
+	s.SoftLimit = 10
+
+	long := "This is a rather long clause, followed by more words"
+	got := s.Push(long)
+	if len(got) != 1 || !strings.HasSuffix(got[0], ",") {
+		t.Fatalf("Push() = %q, want a cut on the comma", got)
+	}
+	if rest := s.Flush(); rest != "followed by more words" {
+		t.Fatalf("Flush() = %q", rest)
+	}
+}
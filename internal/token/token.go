@@ -0,0 +1,84 @@
+// Package token signs and verifies the HMAC tokens handed out by the OTA
+// endpoint and presented by devices when they open a voice session.
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClockSkew is how far in the future a token timestamp may be before it is
+// rejected, to tolerate small clock differences between hub replicas.
+const ClockSkew = time.Minute
+
+var (
+	ErrMissing          = errors.New("missing token")
+	ErrMalformed        = errors.New("malformed token")
+	ErrExpired          = errors.New("token expired")
+	ErrNotYetValid      = errors.New("token issued in the future")
+	ErrInvalidSignature = errors.New("token signature does not match client-id and device-id")
+)
+
+// Sign returns a token in the format `signature.timestamp` where the signature
+// is the HmacSHA256 of `client-id|device-id|timestamp`.
+func Sign(secret, clientID, deviceID string, issuedAt time.Time) string {
+	timestamp := issuedAt.Unix()
+	signature := signature(secret, clientID, deviceID, timestamp)
+
+	return fmt.Sprintf("%s.%d", base64.RawURLEncoding.EncodeToString(signature), timestamp)
+}
+
+// Verify checks that token was issued by Sign for the given client and device
+// and that it is not older than maxAge. A zero maxAge disables the age check.
+func Verify(secret, token, clientID, deviceID string, maxAge time.Duration, now time.Time) error {
+	if fields := strings.Fields(token); len(fields) > 0 && strings.EqualFold(fields[0], "bearer") {
+		token = strings.Join(fields[1:], " ")
+	}
+	token = strings.TrimSpace(token)
+
+	if token == "" {
+		return ErrMissing
+	}
+
+	encoded, ts, ok := strings.Cut(token, ".")
+	if !ok || encoded == "" || ts == "" {
+		return ErrMalformed
+	}
+
+	timestamp, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrMalformed
+	}
+
+	provided, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrMalformed
+	}
+
+	if !hmac.Equal(provided, signature(secret, clientID, deviceID, timestamp)) {
+		return ErrInvalidSignature
+	}
+
+	issuedAt := time.Unix(timestamp, 0)
+	if issuedAt.After(now.Add(ClockSkew)) {
+		return ErrNotYetValid
+	}
+
+	if maxAge > 0 && now.Sub(issuedAt) > maxAge {
+		return ErrExpired
+	}
+
+	return nil
+}
+
+func signature(secret, clientID, deviceID string, timestamp int64) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(fmt.Sprintf("%s|%s|%d", clientID, deviceID, timestamp)))
+	return h.Sum(nil)
+}
@@ -0,0 +1,43 @@
+package token
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	const secret = "s3cr3t"
+	now := time.Unix(1737215340, 0)
+	valid := Sign(secret, "client-1", "aa:bb:cc:dd:ee:ff", now.Add(-time.Hour))
+
+	tests := []struct {
+		name     string
+		token    string
+		clientID string
+		maxAge   time.Duration
+		want     error
+	}{
+		{"valid", valid, "client-1", 24 * time.Hour, nil},
+		{"bearer prefix", "Bearer " + valid, "client-1", 24 * time.Hour, nil},
+		{"no max age", valid, "client-1", 0, nil},
+		{"empty", "", "client-1", 0, ErrMissing},
+		{"bearer only", "Bearer ", "client-1", 0, ErrMissing},
+		{"no timestamp", "abc", "client-1", 0, ErrMalformed},
+		{"bad timestamp", "abc.xyz", "client-1", 0, ErrMalformed},
+		{"bad encoding", "!!!.1737215340", "client-1", 0, ErrMalformed},
+		{"wrong client", valid, "client-2", 24 * time.Hour, ErrInvalidSignature},
+		{"expired", valid, "client-1", 30 * time.Minute, ErrExpired},
+		{"future", Sign(secret, "client-1", "aa:bb:cc:dd:ee:ff", now.Add(time.Hour)), "client-1", 0, ErrNotYetValid},
+		{"other secret", Sign("other", "client-1", "aa:bb:cc:dd:ee:ff", now), "client-1", 0, ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(secret, tt.token, tt.clientID, "aa:bb:cc:dd:ee:ff", tt.maxAge, now)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
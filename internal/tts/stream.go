@@ -0,0 +1,131 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Stream is 16-bit little-endian PCM delivered while it is still being synthesized
+type Stream struct {
+	io.ReadCloser
+	SampleRate int
+	Channels   int
+}
+
+// StreamingSynthesizer is implemented by providers that can hand out audio before synthesis completes
+type StreamingSynthesizer interface {
+	Synthesizer
+	SynthesizeStream(ctx context.Context, text string) (*Stream, error)
+}
+
+// SynthesizeStream streams from s when supported, otherwise it wraps the complete Synthesize output
+func SynthesizeStream(ctx context.Context, s Synthesizer, text string) (*Stream, error) {
+	if streaming, ok := s.(StreamingSynthesizer); ok {
+		return streaming.SynthesizeStream(ctx, text)
+	}
+
+	output, err := s.Synthesize(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	if output.BitDepth != 16 {
+		return nil, fmt.Errorf("unsupported tts bit depth: %d", output.BitDepth)
+	}
+
+	return &Stream{
+		ReadCloser: io.NopCloser(bytes.NewReader(output.Content)),
+		SampleRate: output.SampleRate,
+		Channels:   output.Channels,
+	}, nil
+}
+
+// chunkPipe is an unbounded in-memory pipe: providers pushing audio from a socket
+// read loop must never block on a reader that is still playing the previous sentence.
+type chunkPipe struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	buf     bytes.Buffer
+	err     error
+	closed  bool
+	onClose func()
+}
+
+func newChunkPipe() *chunkPipe {
+	p := &chunkPipe{}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+func (p *chunkPipe) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if p.err != nil {
+		return 0, p.err
+	}
+
+	n, _ := p.buf.Write(b)
+	p.cond.Broadcast()
+	return n, nil
+}
+
+func (p *chunkPipe) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for p.buf.Len() == 0 && p.err == nil && !p.closed {
+		p.cond.Wait()
+	}
+
+	if p.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if p.buf.Len() > 0 {
+		return p.buf.Read(b)
+	}
+
+	return 0, p.err
+}
+
+// CloseWithError ends the write side, readers get err (io.EOF when nil) once the buffer is drained.
+// Only the first call has an effect.
+func (p *chunkPipe) CloseWithError(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return
+	}
+	if err == nil {
+		err = io.EOF
+	}
+	p.err = err
+	p.cond.Broadcast()
+}
+
+// Close is called by the reader, it releases the provider connection
+func (p *chunkPipe) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.buf.Reset()
+	onClose := p.onClose
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	if onClose != nil {
+		onClose()
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package tts
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Synthesizer turns a line of text into PCM audio
+type Synthesizer interface {
+	Synthesize(ctx context.Context, text string) (*Output, error)
+}
+
+// Config is built from a TTS `model_config` record
+type Config struct {
+	Params   map[string]string // config_json with secrets resolved
+	Voice    string            // ai_agent.tts_voice_id, overrides the voice of the model config
+	Language string            // ai_agent.lang_code
+}
+
+// Factory creates a Synthesizer for a provider
+type Factory func(cfg Config) (Synthesizer, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]Factory)
+)
+
+// Register makes a Synthesizer provider available by its `provider_code`
+func Register(providerCode string, factory Factory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[providerCode] = factory
+}
+
+// NewSynthesizer creates the Synthesizer registered for providerCode
+func NewSynthesizer(providerCode string, cfg Config) (Synthesizer, error) {
+	providersMu.RLock()
+	factory, ok := providers[providerCode]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported tts provider: %s", providerCode)
+	}
+
+	if cfg.Params == nil {
+		cfg.Params = make(map[string]string)
+	}
+
+	return factory(cfg)
+}
+
+// voice returns the agent voice, falling back to the first non-empty model config param
+func (c Config) voice(keys ...string) string {
+	if c.Voice != "" {
+		return c.Voice
+	}
+
+	for _, key := range keys {
+		if v := c.Params[key]; v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,186 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lxzan/gws"
+)
+
+func init() {
+	Register("edge", NewEdge)
+}
+
+const (
+	edgeTrustedClientToken = "6A5AA1D4EAFF4E9FB37E23D68491D6F4"
+	edgeChromiumVersion    = "130.0.2849.68"
+	edgeEndpoint           = "wss://speech.platform.bing.com/consumer/speech/synthesize/readaloud/edge/v1"
+	edgeOutputFormat       = "raw-24khz-16bit-mono-pcm"
+	edgeTimestampLayout    = "Mon Jan 02 2006 15:04:05 GMT+0000 (Coordinated Universal Time)"
+)
+
+// Edge uses the Microsoft Edge read aloud service, it needs no API key
+type Edge struct {
+	voice  string
+	rate   string
+	pitch  string
+	volume string
+}
+
+func NewEdge(cfg Config) (Synthesizer, error) {
+	voice := cfg.voice("private_voice", "voice")
+	if voice == "" {
+		voice = "en-US-AvaMultilingualNeural"
+	}
+
+	withDefault := func(key, fallback string) string {
+		if v := cfg.Params[key]; v != "" {
+			return v
+		}
+		return fallback
+	}
+
+	return &Edge{
+		voice:  voice,
+		rate:   withDefault("rate", "+0%"),
+		pitch:  withDefault("pitch", "+0Hz"),
+		volume: withDefault("volume", "+0%"),
+	}, nil
+}
+
+func (e *Edge) Synthesize(ctx context.Context, text string) (*Output, error) {
+	stream, err := e.SynthesizeStream(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	content, err := io.ReadAll(stream)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) == 0 {
+		return nil, errors.New("edge tts returned no audio")
+	}
+
+	return NewOutput(content, stream.SampleRate, stream.Channels, 16)
+}
+
+// SynthesizeStream forwards audio frames as the service sends them, the stream ends on `turn.end`
+func (e *Edge) SynthesizeStream(ctx context.Context, text string) (*Stream, error) {
+	pipe := newChunkPipe()
+	header := http.Header{}
+	header.Set("Origin", "chrome-extension://jdiccldimpdaibmpdkjnbmckianbfold")
+	header.Set("Pragma", "no-cache")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.0.0 Safari/537.36 Edg/130.0.0.0")
+
+	socket, _, err := gws.NewClient(&edgeHandler{pipe: pipe}, &gws.ClientOption{
+		Addr:             edgeURL(time.Now()),
+		RequestHeader:    header,
+		HandshakeTimeout: 10 * time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to edge tts: %w", err)
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		pipe.CloseWithError(ctx.Err())
+		_ = socket.WriteClose(1000, nil)
+	})
+	pipe.onClose = func() {
+		stop()
+		_ = socket.WriteClose(1000, nil)
+	}
+	go socket.ReadLoop()
+
+	timestamp := time.Now().UTC().Format(edgeTimestampLayout)
+	speechConfig := fmt.Sprintf("X-Timestamp:%s\r\nContent-Type:application/json; charset=utf-8\r\nPath:speech.config\r\n\r\n"+
+		`{"context":{"synthesis":{"audio":{"metadataoptions":{"sentenceBoundaryEnabled":"false","wordBoundaryEnabled":"false"},"outputFormat":"%s"}}}}`,
+		timestamp, edgeOutputFormat)
+	ssml := fmt.Sprintf("X-RequestId:%s\r\nContent-Type:application/ssml+xml\r\nX-Timestamp:%sZ\r\nPath:ssml\r\n\r\n%s",
+		strings.ReplaceAll(uuid.NewString(), "-", ""), timestamp, e.ssml(text))
+
+	for _, message := range []string{speechConfig, ssml} {
+		if err := socket.WriteString(message); err != nil {
+			_ = pipe.Close()
+			return nil, fmt.Errorf("failed to send edge tts request: %w", err)
+		}
+	}
+
+	return &Stream{ReadCloser: pipe, SampleRate: 24000, Channels: 1}, nil
+}
+
+func (e *Edge) ssml(text string) string {
+	var escaped bytes.Buffer
+	_ = xml.EscapeText(&escaped, []byte(text))
+
+	// the voice name starts with its locale, e.g. vi-VN-NamMinhNeural
+	lang := "en-US"
+	if parts := strings.SplitN(e.voice, "-", 3); len(parts) == 3 {
+		lang = parts[0] + "-" + parts[1]
+	}
+
+	return fmt.Sprintf("<speak version='1.0' xmlns='http://www.w3.org/2001/10/synthesis' xml:lang='%s'>"+
+		"<voice name='%s'><prosody pitch='%s' rate='%s' volume='%s'>%s</prosody></voice></speak>",
+		lang, e.voice, e.pitch, e.rate, e.volume, escaped.String())
+}
+
+// edgeURL builds the endpoint with the Sec-MS-GEC token, a SHA256 of the
+// Windows file time rounded down to 5 minutes and the trusted client token.
+func edgeURL(now time.Time) string {
+	ticks := now.Unix() + 11644473600
+	ticks -= ticks % 300
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d%s", ticks*10000000, edgeTrustedClientToken)))
+
+	return fmt.Sprintf("%s?TrustedClientToken=%s&Sec-MS-GEC=%s&Sec-MS-GEC-Version=1-%s&ConnectionId=%s",
+		edgeEndpoint, edgeTrustedClientToken, strings.ToUpper(hex.EncodeToString(sum[:])), edgeChromiumVersion,
+		strings.ReplaceAll(uuid.NewString(), "-", ""))
+}
+
+type edgeHandler struct {
+	gws.BuiltinEventHandler
+
+	pipe *chunkPipe
+}
+
+func (h *edgeHandler) OnMessage(socket *gws.Conn, message *gws.Message) {
+	defer message.Close()
+
+	data := message.Bytes()
+	if message.Opcode == gws.OpcodeText {
+		if bytes.Contains(data, []byte("Path:turn.end")) {
+			h.pipe.CloseWithError(nil)
+			_ = socket.WriteClose(1000, nil)
+		}
+		return
+	}
+
+	// binary frames are a 2 bytes header length, the header, then the audio
+	if len(data) < 2 {
+		return
+	}
+	headerLen := int(binary.BigEndian.Uint16(data[:2]))
+	if len(data) < 2+headerLen || !bytes.Contains(data[2:2+headerLen], []byte("Path:audio")) {
+		return
+	}
+
+	_, _ = h.pipe.Write(data[2+headerLen:])
+}
+
+func (h *edgeHandler) OnClose(socket *gws.Conn, err error) {
+	h.pipe.CloseWithError(fmt.Errorf("edge tts connection closed: %w", err))
+}
+
+var _ StreamingSynthesizer = (*Edge)(nil)
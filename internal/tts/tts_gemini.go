@@ -0,0 +1,113 @@
+package tts
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/genai"
+)
+
+func init() {
+	Register("gemini", NewGemini)
+}
+
+// Gemini uses the Gemini API speech generation models
+type Gemini struct {
+	client *genai.Client
+	model  string
+	voice  string
+}
+
+func NewGemini(cfg Config) (Synthesizer, error) {
+	model := cfg.Params["model_name"]
+	if model == "" {
+		model = "gemini-2.5-flash-preview-tts"
+	}
+
+	voice := cfg.voice("voice")
+	if voice == "" {
+		voice = "Algenib"
+	}
+
+	// an empty key makes the client fall back to GEMINI_API_KEY / GOOGLE_API_KEY
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		APIKey:  cfg.Params["api_key"],
+		Backend: genai.BackendGeminiAPI,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gemini client: %w", err)
+	}
+
+	return &Gemini{client: client, model: model, voice: voice}, nil
+}
+
+func (g *Gemini) Synthesize(ctx context.Context, text string) (*Output, error) {
+	resp, err := g.client.Models.GenerateContent(ctx, g.model, genai.Text(fmt.Sprintf("Say: %s", text)), g.config())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return nil, fmt.Errorf("gemini returned no audio")
+	}
+
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if part.InlineData != nil && len(part.InlineData.Data) > 0 {
+			// Gemini speech is raw 24kHz 16-bit mono PCM
+			return NewOutput(part.InlineData.Data, 24000, 1, 16)
+		}
+	}
+
+	return nil, fmt.Errorf("gemini returned no audio")
+}
+
+// SynthesizeStream forwards audio chunks as the model generates them
+func (g *Gemini) SynthesizeStream(ctx context.Context, text string) (*Stream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	pipe := newChunkPipe()
+	pipe.onClose = cancel
+
+	go func() {
+		defer cancel()
+
+		for resp, err := range g.client.Models.GenerateContentStream(ctx, g.model, genai.Text(fmt.Sprintf("Say: %s", text)), g.config()) {
+			if err != nil {
+				pipe.CloseWithError(err)
+				return
+			}
+
+			if len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+				continue
+			}
+
+			for _, part := range resp.Candidates[0].Content.Parts {
+				if part.InlineData == nil || len(part.InlineData.Data) == 0 {
+					continue
+				}
+				if _, err := pipe.Write(part.InlineData.Data); err != nil {
+					return
+				}
+			}
+		}
+
+		pipe.CloseWithError(nil)
+	}()
+
+	return &Stream{ReadCloser: pipe, SampleRate: 24000, Channels: 1}, nil
+}
+
+func (g *Gemini) config() *genai.GenerateContentConfig {
+	return &genai.GenerateContentConfig{
+		Temperature:        genai.Ptr[float32](1.0),
+		ResponseModalities: []string{"AUDIO"},
+		SpeechConfig: &genai.SpeechConfig{
+			VoiceConfig: &genai.VoiceConfig{
+				PrebuiltVoiceConfig: &genai.PrebuiltVoiceConfig{
+					VoiceName: g.voice,
+				},
+			},
+		},
+	}
+}
+
+var _ StreamingSynthesizer = (*Gemini)(nil)
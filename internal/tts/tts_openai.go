@@ -0,0 +1,120 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	Register("openai", NewOpenAi)
+}
+
+// OpenAi talks to any OpenAI compatible `/audio/speech` endpoint
+type OpenAi struct {
+	apiKey   string
+	model    string
+	voice    string
+	speed    float64
+	endpoint string
+}
+
+func NewOpenAi(cfg Config) (Synthesizer, error) {
+	apiKey := cfg.Params["api_key"]
+	if apiKey == "" {
+		apiKey = os.Getenv("OPENAI_API_KEY")
+	}
+
+	model := cfg.Params["model_name"]
+	if model == "" {
+		model = "gpt-4o-mini-tts"
+	}
+
+	voice := cfg.voice("voice")
+	if voice == "" {
+		voice = "alloy"
+	}
+
+	// base_url may either be the API root or the full speech endpoint
+	endpoint := strings.TrimSuffix(cfg.Params["base_url"], "/")
+	if endpoint == "" {
+		endpoint = "https://api.openai.com/v1"
+	}
+	if !strings.HasSuffix(endpoint, "/audio/speech") {
+		endpoint += "/audio/speech"
+	}
+
+	speed, _ := strconv.ParseFloat(cfg.Params["speed"], 64)
+
+	return &OpenAi{
+		apiKey:   apiKey,
+		model:    model,
+		voice:    voice,
+		speed:    speed,
+		endpoint: endpoint,
+	}, nil
+}
+
+func (o *OpenAi) Synthesize(ctx context.Context, text string) (*Output, error) {
+	stream, err := o.SynthesizeStream(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	content, err := io.ReadAll(stream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audio: %w", err)
+	}
+
+	return NewOutput(content, stream.SampleRate, stream.Channels, 16)
+}
+
+// SynthesizeStream hands out the response body, the API sends audio as soon as it is generated
+func (o *OpenAi) SynthesizeStream(ctx context.Context, text string) (*Stream, error) {
+	payload := map[string]any{
+		"model":           o.model,
+		"input":           text,
+		"voice":           o.voice,
+		"response_format": "pcm", // raw 24kHz 16-bit mono
+	}
+	if o.speed > 0 {
+		payload["speed"] = o.speed
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("openai api error (status %d): %s", resp.StatusCode, string(respBody))
+	}
+
+	return &Stream{ReadCloser: resp.Body, SampleRate: 24000, Channels: 1}, nil
+}
+
+var _ StreamingSynthesizer = (*OpenAi)(nil)
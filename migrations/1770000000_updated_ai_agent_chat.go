@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// ai_agent_chat keeps the LLM context of a conversation so a device reconnecting
+// shortly after can resume it.
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("ai_agent_chat")
+		if err != nil {
+			return err
+		}
+
+		devices, err := app.FindCollectionByNameOrId("ai_device")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.Add(
+			&core.RelationField{
+				Name:          "device",
+				CollectionId:  devices.Id,
+				MaxSelect:     1,
+				CascadeDelete: false,
+			},
+			&core.JSONField{
+				Name:    "context",
+				MaxSize: 2 << 20,
+				Hidden:  true,
+			},
+		)
+		collection.AddIndex("idx_ai_agent_chat_device", false, "`device`, `updated`", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("ai_agent_chat")
+		if err != nil {
+			return err
+		}
+
+		collection.RemoveIndex("idx_ai_agent_chat_device")
+		collection.Fields.RemoveByName("device")
+		collection.Fields.RemoveByName("context")
+
+		return app.Save(collection)
+	})
+}
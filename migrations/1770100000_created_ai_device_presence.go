@@ -0,0 +1,86 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// ai_device_connection keeps one record per device connection, ai_device_presence one
+// record per device that the UI subscribes to for the online status.
+func init() {
+	m.Register(func(app core.App) error {
+		devices, err := app.FindCollectionByNameOrId("ai_device")
+		if err != nil {
+			return err
+		}
+
+		ownerRule := types.Pointer("device.user = @request.auth.id")
+
+		connections := core.NewBaseCollection("ai_device_connection")
+		connections.ListRule = ownerRule
+		connections.ViewRule = ownerRule
+		connections.Fields.Add(
+			&core.RelationField{
+				Name:          "device",
+				CollectionId:  devices.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			},
+			&core.TextField{Name: "session"},
+			&core.SelectField{Name: "transport", MaxSelect: 1, Values: []string{"websocket", "mqtt"}},
+			&core.TextField{Name: "ip"},
+			&core.NumberField{Name: "client_version", OnlyInt: true},
+			&core.DateField{Name: "connected"},
+			&core.DateField{Name: "disconnected"},
+			&core.NumberField{Name: "duration", OnlyInt: true},
+			&core.TextField{Name: "close_reason", Max: 512},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		connections.AddIndex("idx_ai_device_connection_device", false, "`device`, `connected`", "")
+
+		if err := app.Save(connections); err != nil {
+			return err
+		}
+
+		presence := core.NewBaseCollection("ai_device_presence")
+		presence.ListRule = ownerRule
+		presence.ViewRule = ownerRule
+		presence.Fields.Add(
+			&core.RelationField{
+				Name:          "device",
+				CollectionId:  devices.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			},
+			&core.BoolField{Name: "online"},
+			&core.RelationField{
+				Name:         "connection",
+				CollectionId: connections.Id,
+				MaxSelect:    1,
+			},
+			&core.DateField{Name: "last_seen"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		presence.AddIndex("idx_ai_device_presence_device", true, "`device`", "")
+
+		return app.Save(presence)
+	}, func(app core.App) error {
+		for _, name := range []string{"ai_device_presence", "ai_device_connection"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+
+			if err := app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,109 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// ai_reminder holds scheduled announcements of an agent, ai_reminder_delivery one
+// record per device and firing so that offline devices get it on their next connection.
+func init() {
+	m.Register(func(app core.App) error {
+		agents, err := app.FindCollectionByNameOrId("ai_agent")
+		if err != nil {
+			return err
+		}
+
+		devices, err := app.FindCollectionByNameOrId("ai_device")
+		if err != nil {
+			return err
+		}
+
+		agentOwner := types.Pointer("agent.user = @request.auth.id")
+		// a reminder may only target a device of the same owner
+		ownedTarget := types.Pointer("agent.user = @request.auth.id && (device = '' || device.user = @request.auth.id)")
+
+		reminders := core.NewBaseCollection("ai_reminder")
+		reminders.ListRule = agentOwner
+		reminders.ViewRule = agentOwner
+		reminders.CreateRule = ownedTarget
+		reminders.UpdateRule = ownedTarget
+		reminders.DeleteRule = agentOwner
+		reminders.Fields.Add(
+			&core.RelationField{
+				Name:          "agent",
+				CollectionId:  agents.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			},
+			&core.RelationField{
+				Name:          "device",
+				CollectionId:  devices.Id,
+				MaxSelect:     1,
+				CascadeDelete: true,
+			},
+			&core.TextField{Name: "message", Required: true, Max: 2000},
+			&core.SelectField{Name: "mode", MaxSelect: 1, Values: []string{"fixed", "generate"}},
+			&core.TextField{Name: "schedule", Max: 100},
+			&core.DateField{Name: "run_at"},
+			&core.TextField{Name: "timezone", Max: 64},
+			&core.BoolField{Name: "enabled"},
+			&core.DateField{Name: "last_run"},
+			&core.SelectField{Name: "source", MaxSelect: 1, Values: []string{"user", "llm"}},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		reminders.AddIndex("idx_ai_reminder_enabled", false, "`enabled`, `run_at`", "")
+
+		if err := app.Save(reminders); err != nil {
+			return err
+		}
+
+		deviceOwner := types.Pointer("device.user = @request.auth.id")
+
+		deliveries := core.NewBaseCollection("ai_reminder_delivery")
+		deliveries.ListRule = deviceOwner
+		deliveries.ViewRule = deviceOwner
+		deliveries.Fields.Add(
+			&core.RelationField{
+				Name:          "reminder",
+				CollectionId:  reminders.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			},
+			&core.RelationField{
+				Name:          "device",
+				CollectionId:  devices.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			},
+			&core.TextField{Name: "text", Max: 2000},
+			&core.SelectField{Name: "mode", MaxSelect: 1, Values: []string{"fixed", "generate"}},
+			&core.SelectField{Name: "status", MaxSelect: 1, Values: []string{"pending", "sending", "delivered", "failed"}},
+			&core.DateField{Name: "delivered"},
+			&core.TextField{Name: "error", Max: 512},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		deliveries.AddIndex("idx_ai_reminder_delivery_device", false, "`device`, `status`", "")
+
+		return app.Save(deliveries)
+	}, func(app core.App) error {
+		for _, name := range []string{"ai_reminder_delivery", "ai_reminder"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+
+			if err := app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,62 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// ai_agent_mcp_server connects an agent to external MCP servers. It stays superuser only:
+// stdio servers run commands on the hub and headers may carry credentials.
+func init() {
+	m.Register(func(app core.App) error {
+		agents, err := app.FindCollectionByNameOrId("ai_agent")
+		if err != nil {
+			return err
+		}
+
+		credentials, err := app.FindCollectionByNameOrId("user_credentials")
+		if err != nil {
+			return err
+		}
+
+		collection := core.NewBaseCollection("ai_agent_mcp_server")
+		collection.Fields.Add(
+			&core.RelationField{
+				Name:          "agent",
+				CollectionId:  agents.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			},
+			// prefixes the tool names, so it cannot contain the `-` of the device tool prefix
+			&core.TextField{Name: "name", Required: true, Max: 32, Pattern: "^[a-z][a-z0-9_]*$"},
+			&core.SelectField{Name: "transport", Required: true, MaxSelect: 1, Values: []string{"stdio", "http"}},
+			&core.TextField{Name: "command"},
+			&core.JSONField{Name: "args"},
+			&core.JSONField{Name: "env"},
+			&core.URLField{Name: "url"},
+			&core.JSONField{Name: "headers"},
+			&core.RelationField{
+				Name:         "credential",
+				CollectionId: credentials.Id,
+				MaxSelect:    1,
+			},
+			&core.JSONField{Name: "disabled_tools"},
+			&core.NumberField{Name: "timeout", Min: types.Pointer(0.0), OnlyInt: true},
+			&core.BoolField{Name: "enabled"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_ai_agent_mcp_server_name", true, "`agent`, `name`", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("ai_agent_mcp_server")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+	})
+}
@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// mcp_tools keeps the last tool catalogue of the device MCP server, so the UI can show it while offline
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("ai_device")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.Add(
+			&core.JSONField{Name: "mcp_tools"},
+			&core.DateField{Name: "mcp_tools_updated"},
+		)
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("ai_device")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.RemoveByName("mcp_tools")
+		collection.Fields.RemoveByName("mcp_tools_updated")
+
+		return app.Save(collection)
+	})
+}
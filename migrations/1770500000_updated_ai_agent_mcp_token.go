@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// mcp_token holds the SHA-256 of the token external MCP clients use to drive the agent
+func init() {
+	m.Register(func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("ai_agent")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.Add(&core.TextField{Name: "mcp_token", Hidden: true, Max: 64})
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("ai_agent")
+		if err != nil {
+			return err
+		}
+
+		collection.Fields.RemoveByName("mcp_token")
+
+		return app.Save(collection)
+	})
+}
@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// ai_firmware is the catalogue of OTA builds, managed by superusers. The file is protected,
+// devices download it through the signed /xiaozhi/ota/firmware route.
+func init() {
+	m.Register(func(app core.App) error {
+		collection := core.NewBaseCollection("ai_firmware")
+		collection.ListRule = types.Pointer("@request.auth.id != ''")
+		collection.ViewRule = types.Pointer("@request.auth.id != ''")
+		collection.Fields.Add(
+			// board.type reported by the firmware, e.g. bread-compact-wifi
+			&core.TextField{Name: "board", Required: true, Max: 100},
+			&core.TextField{Name: "version", Required: true, Max: 50, Pattern: `^v?\d+(\.\d+){0,2}(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?$`},
+			&core.FileField{Name: "file", Required: true, MaxSelect: 1, MaxSize: 32 << 20, Protected: true},
+			&core.TextField{Name: "release_notes", Max: 10000},
+			// set from the uploaded file
+			&core.TextField{Name: "sha256", Max: 64},
+			&core.NumberField{Name: "size", OnlyInt: true},
+			&core.BoolField{Name: "enabled"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		collection.AddIndex("idx_ai_firmware_board_version", true, "`board`, `version`", "")
+
+		return app.Save(collection)
+	}, func(app core.App) error {
+		collection, err := app.FindCollectionByNameOrId("ai_firmware")
+		if err != nil {
+			return err
+		}
+
+		return app.Delete(collection)
+	})
+}
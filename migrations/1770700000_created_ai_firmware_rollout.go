@@ -0,0 +1,118 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// ai_firmware_rollout stages a build to a cohort of devices, ai_firmware_rollout_device tracks
+// every device it was offered to. Devices get tags to build cohorts and can be pinned to a build.
+func init() {
+	m.Register(func(app core.App) error {
+		builds, err := app.FindCollectionByNameOrId("ai_firmware")
+		if err != nil {
+			return err
+		}
+
+		devices, err := app.FindCollectionByNameOrId("ai_device")
+		if err != nil {
+			return err
+		}
+
+		devices.Fields.Add(
+			&core.JSONField{Name: "tags"},
+			&core.RelationField{Name: "pinned_firmware", CollectionId: builds.Id, MaxSelect: 1},
+		)
+		if err := app.Save(devices); err != nil {
+			return err
+		}
+
+		rollouts := core.NewBaseCollection("ai_firmware_rollout")
+		rollouts.ListRule = types.Pointer("@request.auth.id != ''")
+		rollouts.ViewRule = types.Pointer("@request.auth.id != ''")
+		rollouts.Fields.Add(
+			&core.RelationField{
+				Name:          "firmware",
+				CollectionId:  builds.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			},
+			&core.SelectField{Name: "status", Required: true, MaxSelect: 1, Values: []string{"active", "paused", "halted", "completed"}},
+			&core.NumberField{Name: "percent", OnlyInt: true, Min: types.Pointer(0.0), Max: types.Pointer(100.0)},
+			&core.JSONField{Name: "tags"},
+			// failed devices tolerated, one more halts the rollout
+			&core.NumberField{Name: "max_failures", OnlyInt: true, Min: types.Pointer(0.0)},
+			// minutes a device has to check in with the new version after the download
+			&core.NumberField{Name: "check_in_timeout", OnlyInt: true, Min: types.Pointer(0.0)},
+			// counters kept by the rollout controller
+			&core.NumberField{Name: "offered", OnlyInt: true},
+			&core.NumberField{Name: "downloaded", OnlyInt: true},
+			&core.NumberField{Name: "updated", OnlyInt: true},
+			&core.NumberField{Name: "failed", OnlyInt: true},
+			&core.TextField{Name: "halt_reason", Max: 512},
+			&core.DateField{Name: "halted"},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		rollouts.AddIndex("idx_ai_firmware_rollout_status", false, "`status`", "")
+		if err := app.Save(rollouts); err != nil {
+			return err
+		}
+
+		deviceOwner := types.Pointer("device.user = @request.auth.id")
+
+		tracks := core.NewBaseCollection("ai_firmware_rollout_device")
+		tracks.ListRule = deviceOwner
+		tracks.ViewRule = deviceOwner
+		tracks.Fields.Add(
+			&core.RelationField{
+				Name:          "rollout",
+				CollectionId:  rollouts.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			},
+			&core.RelationField{
+				Name:          "device",
+				CollectionId:  devices.Id,
+				MaxSelect:     1,
+				Required:      true,
+				CascadeDelete: true,
+			},
+			&core.SelectField{Name: "status", MaxSelect: 1, Values: []string{"offered", "downloaded", "updated", "failed"}},
+			&core.TextField{Name: "from_version", Max: 50},
+			&core.TextField{Name: "reported_version", Max: 50},
+			&core.DateField{Name: "offered"},
+			&core.DateField{Name: "downloaded"},
+			&core.DateField{Name: "checked"},
+			&core.TextField{Name: "error", Max: 512},
+			&core.AutodateField{Name: "created", OnCreate: true},
+			&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true},
+		)
+		tracks.AddIndex("idx_ai_firmware_rollout_device", true, "`rollout`, `device`", "")
+
+		return app.Save(tracks)
+	}, func(app core.App) error {
+		for _, name := range []string{"ai_firmware_rollout_device", "ai_firmware_rollout"} {
+			collection, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			if err := app.Delete(collection); err != nil {
+				return err
+			}
+		}
+
+		devices, err := app.FindCollectionByNameOrId("ai_device")
+		if err != nil {
+			return err
+		}
+
+		devices.Fields.RemoveByName("tags")
+		devices.Fields.RemoveByName("pinned_firmware")
+
+		return app.Save(devices)
+	})
+}
@@ -1,7 +1,7 @@
 import { useState, useEffect } from "react"
 import { toast } from "sonner"
 import { pb } from "@/lib/api"
-import type { AIAgent, AIDevice } from "./types"
+import type { AIAgent, AIDevice, AIDevicePresence } from "./types"
 import { Button } from "@/components/ui/button"
 import { Dialog, DialogContent, DialogHeader, DialogTitle, DialogTrigger } from "@/components/ui/dialog"
 import { Smartphone } from "lucide-react"
@@ -40,6 +40,7 @@ function DeviceListModal({ agent }: { agent: AIAgent }) {
 	const [loading, setLoading] = useState(false)
 	const [open, setOpen] = useState(false)
 	const [deviceCount, setDeviceCount] = useState<number | null>(null)
+	const [presence, setPresence] = useState<Record<string, AIDevicePresence>>({})
 
 	useEffect(() => {
 		// Fetch count on mount
@@ -79,6 +80,29 @@ function DeviceListModal({ agent }: { agent: AIAgent }) {
 		}
 	}, [open])
 
+	// online status is pushed by the hub while the dialog is open
+	useEffect(() => {
+		if (!open) {
+			return
+		}
+
+		const track = (record: AIDevicePresence) => setPresence((prev) => ({ ...prev, [record.device]: record }))
+		pb.collection("ai_device_presence")
+			.getFullList<AIDevicePresence>({ filter: `device.agent = "${agent.id}"` })
+			.then((records) => records.forEach(track))
+			.catch((err) => console.error("Error fetching device presence:", err))
+
+		pb.collection("ai_device_presence").subscribe<AIDevicePresence>("*", (e) => {
+			if (e.action !== "delete") {
+				track(e.record)
+			}
+		})
+
+		return () => {
+			pb.collection("ai_device_presence").unsubscribe("*")
+		}
+	}, [open, agent.id])
+
 	return (
 		<Dialog open={open} onOpenChange={setOpen}>
 			<DialogTrigger asChild>
@@ -108,8 +132,13 @@ function DeviceListModal({ agent }: { agent: AIAgent }) {
 									<div className="flex flex-col">
 										<span className="font-medium">{dev.mac_address}</span>
 										<span className="text-xs text-muted-foreground">{dev.board}</span>
+										{dev.mcp_tools?.length ? (
+											<span className="text-xs text-muted-foreground">
+												Tools: {dev.mcp_tools.map((tool) => tool.name).join(", ")}
+											</span>
+										) : null}
 									</div>
-									<div className="text-xs text-muted-foreground">{new Date(dev.created).toLocaleDateString()}</div>
+									<DevicePresence presence={presence[dev.id]} />
 								</div>
 							))}
 						</div>
@@ -119,3 +148,21 @@ function DeviceListModal({ agent }: { agent: AIAgent }) {
 		</Dialog>
 	)
 }
+
+function DevicePresence({ presence }: { presence?: AIDevicePresence }) {
+	if (presence?.online) {
+		return (
+			<div className="flex items-center gap-1 text-xs text-muted-foreground">
+				<span className="size-2 rounded-full bg-green-500" />
+				Online
+			</div>
+		)
+	}
+
+	return (
+		<div className="flex items-center gap-1 text-xs text-muted-foreground">
+			<span className="size-2 rounded-full bg-muted-foreground/40" />
+			{presence?.last_seen ? `Last seen ${new Date(presence.last_seen).toLocaleString()}` : "Never connected"}
+		</div>
+	)
+}
@@ -30,4 +30,17 @@ export interface AIDevice extends RecordModel {
 	agent: string
 	board: string
 	last_connected: string
+	mcp_tools?: AIDeviceTool[] | null
+}
+
+export interface AIDeviceTool {
+	name: string
+	description?: string
+}
+
+export interface AIDevicePresence extends RecordModel {
+	device: string
+	online: boolean
+	connection: string
+	last_seen: string
 }
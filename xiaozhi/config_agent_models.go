@@ -2,7 +2,6 @@ package xiaozhi
 
 import (
 	"encoding/json"
-	"errors"
 	"net/http"
 
 	"github.com/phamviet/xiaozhi-hub/xiaozhi/types"
@@ -84,38 +83,18 @@ func (m *Manager) getAgentModels(e *core.RequestEvent) error {
 		response.ChatHistoryConf = 2 // store voice & message
 	}
 
-	getModelConfigJson := func(id string, modelType string) (*types.ModelConfigJson, error) {
-		modelConfig, err := m.Store.GetModelConfigByIDOrDefault(id, modelType)
-		if err != nil {
-			return nil, err
-		}
-
-		if modelConfig.ProviderID == "" {
-			e.App.Logger().Error("Model provider_id is empty. Hint: config_json may have unexpected value", "id", id, "name", modelConfig.ModelName)
-			return nil, errors.New("model provider_id is empty")
-		}
-
-		providerCode, err := m.Store.GetProviderCodeByID(modelConfig.ProviderID)
-		if err != nil {
-			e.App.Logger().Error("Model provider not found", "id", modelConfig.ProviderID, "error", err)
-			return nil, errors.New("model provider not found")
-		}
-
-		return modelConfig.ToModelConfigJson(providerCode), nil
-	}
-
 	var selectedModule = make(map[string]string)
 	llmIDs := make([]string, 0)
 
 	loadModelConfig := func(id string, modelType string) error {
-		modelConfig, err := getModelConfigJson(id, modelType)
+		// same resolution as the device pipeline, provider code and secrets included
+		modelConfig, err := m.Store.GetModelConfigJson(id, modelType)
 		if err != nil {
-			e.App.Logger().Error("Failed to get model config", "model_type", modelType, "error", err)
+			e.App.Logger().Error("Failed to get model config", "id", id, "model_type", modelType, "error", err)
 			return err
 		}
 
 		if modelConfig != nil {
-			m.Store.ResolveSecretReference(modelConfig)
 			selectedModule[modelType] = modelConfig.ID
 			if modelConfig.IsLLMReference() {
 				llmIDs = append(llmIDs, modelConfig.Param["llm"])
@@ -143,9 +122,12 @@ func (m *Manager) getAgentModels(e *core.RequestEvent) error {
 		if response.ModelConfigMap["LLM"] != nil && response.ModelConfigMap["LLM"][llmID] != nil {
 			continue
 		}
-		modelConfig, err := getModelConfigJson(llmID, "LLM")
-		if err == nil && modelConfig != nil {
-			m.Store.ResolveSecretReference(modelConfig)
+		modelConfig, err := m.Store.GetModelConfigJson(llmID, "LLM")
+		if err != nil {
+			e.App.Logger().Error("Failed to get referenced LLM config", "id", llmID, "error", err)
+			continue
+		}
+		if modelConfig != nil {
 			if response.ModelConfigMap["LLM"] == nil {
 				response.ModelConfigMap["LLM"] = make(map[string]*types.ModelConfigJson)
 			}
@@ -3,6 +3,7 @@ package xiaozhi
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/phamviet/xiaozhi-hub/internal/hub"
 	"github.com/phamviet/xiaozhi-hub/xiaozhi/store"
@@ -14,6 +15,7 @@ var _ hub.Plugin = (*Manager)(nil)
 type Manager struct {
 	App   core.App
 	Store *store.Manager
+	hub   *hub.Hub
 }
 
 func NewManager() *Manager {
@@ -26,12 +28,31 @@ func (m *Manager) Name() string {
 
 func (m *Manager) Initialize(hub *hub.Hub) error {
 	m.App = hub.App
+	m.hub = hub
+
+	// checksum and size come from the upload, admins only provide the file
+	hashFirmware := func(e *core.RecordEvent) error {
+		if err := store.HashFirmwareUpload(e.Record); err != nil {
+			return err
+		}
+		return e.Next()
+	}
+	hub.App.OnRecordCreate(store.FirmwareCollectionName).BindFunc(hashFirmware)
+	hub.App.OnRecordUpdate(store.FirmwareCollectionName).BindFunc(hashFirmware)
+
 	hub.App.OnServe().BindFunc(func(e *core.ServeEvent) error {
 		m.Store = store.NewManager(hub.App)
 		if err := m.registerAuthRoutes(e); err != nil {
 			return err
 		}
 
+		// rollouts are judged from the OTA checks devices make after taking the update
+		e.App.Cron().MustAdd("firmware_rollouts", "* * * * *", func() {
+			if err := m.Store.EvaluateRollouts(time.Now()); err != nil {
+				e.App.Logger().Error("Failed to evaluate firmware rollouts", "error", err)
+			}
+		})
+
 		return e.Next()
 	})
 
@@ -43,6 +64,7 @@ func (m *Manager) registerAuthRoutes(se *core.ServeEvent) error {
 	xiaozhi.POST("/ota", m.otaRequest)
 	xiaozhi.POST("/ota/activate", m.otaActivateRequest)
 	xiaozhi.POST("/ota/bind-device", m.otaBindDeviceRequest)
+	xiaozhi.GET("/ota/firmware/{id}", m.otaFirmwareDownload)
 
 	// Ensure ending slash is supported
 	xiaozhi.POST("/ota/", m.otaRequest)
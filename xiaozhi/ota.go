@@ -3,14 +3,19 @@ package xiaozhi
 import (
 	"crypto/hmac"
 	"crypto/sha256"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"regexp"
+	"strconv"
 	"time"
 
+	"github.com/phamviet/xiaozhi-hub/internal/firmware"
+	"github.com/phamviet/xiaozhi-hub/internal/hub/mqtt"
+	"github.com/phamviet/xiaozhi-hub/internal/token"
+	"github.com/phamviet/xiaozhi-hub/xiaozhi/store"
 	"github.com/phamviet/xiaozhi-hub/xiaozhi/types"
 	"github.com/pocketbase/pocketbase/core"
 )
@@ -46,6 +51,7 @@ type OTAResponse struct {
 		URL   string `json:"url"`
 		Token string `json:"token"`
 	} `json:"websocket"`
+	MQTT       *OTAMqtt `json:"mqtt,omitempty"`
 	Activation struct {
 		Code      string `json:"code,omitempty"`
 		Challenge string `json:"challenge,omitempty"`
@@ -53,6 +59,16 @@ type OTAResponse struct {
 	} `json:"activation,omitempty"`
 }
 
+// OTAMqtt switches the firmware to the MQTT + UDP transport, the password is the same token as the websocket one
+type OTAMqtt struct {
+	Endpoint       string `json:"endpoint"`
+	ClientID       string `json:"client_id"`
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	PublishTopic   string `json:"publish_topic"`
+	SubscribeTopic string `json:"subscribe_topic"`
+}
+
 type ActivationRequest struct {
 	Payload struct {
 		Algorithm    string `json:"algorithm"`
@@ -141,19 +157,11 @@ func (m *Manager) otaRequest(e *core.RequestEvent) error {
 	wsURL := fmt.Sprintf("%s://%s/api/v1", scheme, e.Request.Host)
 
 	now := time.Now()
-	timestamp := now.Unix()
 
 	tokenString := ""
 	if secret != "" {
-		// token content: client-id + |device-id + |current_timestamp
-		message := fmt.Sprintf("%s|%s|%d", clientID, deviceID, timestamp)
-		h := hmac.New(sha256.New, []byte(secret))
-		h.Write([]byte(message))
-		signature := h.Sum(nil)
-		signatureBase64 := base64.RawURLEncoding.EncodeToString(signature)
-
-		// The final token format is: signature.timestamp
-		tokenString = fmt.Sprintf("%s.%d", signatureBase64, timestamp)
+		// token content: client-id + |device-id + |current_timestamp, verified again by /api/v1
+		tokenString = token.Sign(secret, clientID, deviceID, now)
 	}
 
 	response := OTAResponse{}
@@ -161,12 +169,46 @@ func (m *Manager) otaRequest(e *core.RequestEvent) error {
 	response.ServerTime.TimeZone = "Asia/Ho_Chi_Minh"
 	response.ServerTime.TimezoneOffset = 420
 
-	response.Firmware.Version = "1.0.0"
-	response.Firmware.URL = "http://xiaozhi.server.com:8002/xiaozhi/otaMag/download/NOT_ACTIVATED_FIRMWARE_THIS_IS_A_INVALID_URL"
+	// the firmware only upgrades when the version is newer than its own and the url is set
+	response.Firmware.Version = req.Application.Version
+	if device != nil && bindCode == "" {
+		if err := m.Store.UpdateDeviceFirmware(device.Id, req.Application.Version); err != nil {
+			e.App.Logger().Warn("Failed to record firmware version", "error", err, "deviceId", deviceID)
+		}
+
+		if secret != "" {
+			build, rolloutID, err := m.Store.ResolveFirmware(device, req.Board.Type, req.Application.Version)
+			if err != nil {
+				e.App.Logger().Error("Failed to resolve firmware", "error", err, "board", req.Board.Type)
+			} else if build != nil {
+				response.Firmware.Version = build.GetString("version")
+				response.Firmware.URL = firmwareURL(e, secret, build.Id, device.Id, now)
+			}
+
+			if rolloutID != "" {
+				if err := m.Store.RecordOffer(rolloutID, device.Id, req.Application.Version); err != nil {
+					e.App.Logger().Error("Failed to record rollout offer", "error", err, "rollout", rolloutID)
+				}
+			}
+		}
+	}
 
 	response.Websocket.URL = wsURL
 	response.Websocket.Token = tokenString
 
+	// only bound devices can open a session, the others keep polling OTA for activation.
+	// Devices stop using the WebSocket once given MQTT, so it is only offered while the gateway runs.
+	if endpoint := m.hub.MqttEndpoint(); endpoint != "" && tokenString != "" && bindCode == "" {
+		response.MQTT = &OTAMqtt{
+			Endpoint:       endpoint,
+			ClientID:       mqtt.ClientID(deviceID, clientID),
+			Username:       deviceID,
+			Password:       tokenString,
+			PublishTopic:   mqtt.PublishTopic,
+			SubscribeTopic: mqtt.SubscribeTopic(deviceID),
+		}
+	}
+
 	if bindCode != "" {
 		response.Activation.Code = bindCode
 		response.Activation.Challenge = challenge
@@ -176,6 +218,64 @@ func (m *Manager) otaRequest(e *core.RequestEvent) error {
 	return e.JSON(http.StatusOK, response)
 }
 
+// firmwareLinkTTL bounds how long an offered download link works, the device fetches it right after the check
+const firmwareLinkTTL = time.Hour
+
+// firmwareURL returns the signed download link of a build for a device on the host the device reached
+func firmwareURL(e *core.RequestEvent, secret, id, deviceID string, now time.Time) string {
+	scheme := "http"
+	if "https" == e.Request.Header.Get("X-Forwarded-Proto") || e.Request.TLS != nil {
+		scheme = "https"
+	}
+
+	expires := now.Add(firmwareLinkTTL)
+	query := url.Values{
+		"device":  {deviceID},
+		"expires": {strconv.FormatInt(expires.Unix(), 10)},
+		"sig":     {firmware.Sign(secret, id, deviceID, expires)},
+	}
+
+	return fmt.Sprintf("%s://%s/xiaozhi/ota/firmware/%s?%s", scheme, e.Request.Host, id, query.Encode())
+}
+
+// otaFirmwareDownload /xiaozhi/ota/firmware/{id}, the link is only valid as signed by otaRequest
+func (m *Manager) otaFirmwareDownload(e *core.RequestEvent) error {
+	id := e.Request.PathValue("id")
+	secret, err := m.Store.GetSysParam("server.secret")
+	if err != nil || secret == "" {
+		return e.NotFoundError("firmware not found", err)
+	}
+
+	query := e.Request.URL.Query()
+	deviceID := query.Get("device")
+	if err := firmware.Verify(secret, id, deviceID, query.Get("expires"), query.Get("sig"), time.Now()); err != nil {
+		return e.ForbiddenError(err.Error(), nil)
+	}
+
+	build, err := e.App.FindRecordById(store.FirmwareCollectionName, id)
+	if err != nil || !build.GetBool("enabled") {
+		return e.NotFoundError("firmware not found", err)
+	}
+
+	// the device took the update, a rollout now waits for it to check in with the new version
+	if err := m.Store.RecordDownload(build.Id, deviceID); err != nil {
+		e.App.Logger().Error("Failed to record firmware download", "error", err, "deviceId", deviceID)
+	}
+
+	fsys, err := e.App.NewFilesystem()
+	if err != nil {
+		return err
+	}
+	defer fsys.Close()
+
+	if sum := build.GetString("sha256"); sum != "" {
+		e.Response.Header().Set("X-Checksum-Sha256", sum)
+	}
+
+	name := build.GetString("file")
+	return fsys.Serve(e.Response, e.Request, build.BaseFilesPath()+"/"+name, name)
+}
+
 // otaActivateRequest /xiaozhi/ota/activate
 func (m *Manager) otaActivateRequest(e *core.RequestEvent) error {
 	macAddress := e.Request.Header.Get("device-id")
@@ -40,6 +40,16 @@ func seedSysParams(app core.App) error {
 		{"name": "memory.system_prompt", "value": prompt},
 		{"name": "server.secret", "value": uuid.New().String()},
 		{"name": "server.websocket", "value": "ws://REPLACE_WITH_YOUR_SERVER_IP:8090/xiaozhi/v1"},
+		{"name": "server.token_max_age", "value": "604800"},
+		// IANA name, reminder times given by users and the LLM are in this timezone
+		{"name": "server.timezone", "value": "Asia/Ho_Chi_Minh"},
+		// seconds a device MCP tool call may take before the LLM is told it failed
+		{"name": "mcp.tool_timeout", "value": "15"},
+		// MQTT + UDP transport, disabled until mqtt.endpoint is set to the public broker host:port
+		{"name": "mqtt.endpoint", "value": ""},
+		{"name": "mqtt.listen_addr", "value": ":1883"},
+		{"name": "udp.listen_addr", "value": ":8884"},
+		{"name": "udp.public_addr", "value": ""},
 	}
 
 	collection, err := app.FindCollectionByNameOrId("sys_params")
@@ -111,6 +121,102 @@ func seedModelProviders(app core.App) error {
     "key": "out_dir",
     "value": "tmp/"
   }
+]`,
+		},
+		{
+			"id":            "szyhrhpprjw9j07",
+			"name":          "SherpaOnnx",
+			"provider_code": "sherpa_onnx",
+			"model_type":    "ASR",
+			"fields": `[
+  {
+    "key": "model_type",
+    "type": "string",
+    "label": "Model type (whisper, paraformer, sense_voice)"
+  },
+  {
+    "key": "model_dir",
+    "type": "string",
+    "label": "Model dir"
+  },
+  {
+    "key": "encoder",
+    "type": "string",
+    "label": "Encoder (whisper)"
+  },
+  {
+    "key": "decoder",
+    "type": "string",
+    "label": "Decoder (whisper)"
+  },
+  {
+    "key": "model",
+    "type": "string",
+    "label": "Model (paraformer, sense_voice)"
+  },
+  {
+    "key": "tokens",
+    "type": "string",
+    "label": "Tokens"
+  },
+  {
+    "key": "num_threads",
+    "type": "number",
+    "label": "num_threads"
+  }
+]`,
+		},
+		{
+			"id":            "1lgy035p2yp0bf0",
+			"name":          "SherpaOnnxStreaming",
+			"provider_code": "sherpa_onnx_streaming",
+			"model_type":    "ASR",
+			"fields": `[
+  {
+    "key": "model_type",
+    "type": "string",
+    "label": "Model type (transducer, paraformer, zipformer2_ctc)"
+  },
+  {
+    "key": "model_dir",
+    "type": "string",
+    "label": "Model dir"
+  },
+  {
+    "key": "encoder",
+    "type": "string",
+    "label": "Encoder"
+  },
+  {
+    "key": "decoder",
+    "type": "string",
+    "label": "Decoder"
+  },
+  {
+    "key": "joiner",
+    "type": "string",
+    "label": "Joiner (transducer)"
+  },
+  {
+    "key": "model",
+    "type": "string",
+    "label": "Model (zipformer2_ctc)"
+  },
+  {
+    "key": "tokens",
+    "type": "string",
+    "label": "Tokens"
+  },
+  {
+    "key": "num_threads",
+    "type": "number",
+    "label": "num_threads"
+  },
+  {
+    "key": "rule2_min_trailing_silence",
+    "type": "number",
+    "label": "Endpoint trailing silence (seconds)"
+  }
 ]`,
 		},
 		{
@@ -215,6 +321,34 @@ func seedModelProviders(app core.App) error {
     "type": "string",
     "label": "Voice"
   }
+]`,
+		},
+		{
+			"id":            "qkhuoju2cimxqqs",
+			"name":          "GeminiTTS",
+			"provider_code": "gemini",
+			"model_type":    "TTS",
+			"fields": `[
+  {
+    "key": "api_key",
+    "type": "string",
+    "label": "API key"
+  },
+  {
+    "key": "secret_ref",
+    "type": "string",
+    "label": "Use credential"
+  },
+  {
+    "key": "model_name",
+    "type": "string",
+    "label": "Model name"
+  },
+  {
+    "key": "voice",
+    "type": "string",
+    "label": "Voice"
+  }
 ]`,
 		},
 		{
@@ -74,7 +74,7 @@ type ChatHistoryParams struct {
 	ChatType    string
 	AudioBytes  []byte
 	ReportTime  int64
-	AudioFormat string // "mp3"
+	AudioFormat string // "mp3" or "wav"
 }
 
 func (m *Manager) SaveChatHistory(params ChatHistoryParams) error {
@@ -3,6 +3,7 @@ package store
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 
 	"github.com/phamviet/xiaozhi-hub/xiaozhi/types"
 	"github.com/pocketbase/dbx"
@@ -41,6 +42,30 @@ func (m *Manager) GetModelConfigByIDOrDefault(id string, modelType string) (*typ
 	return m.GetDefaultModelConfig(modelType)
 }
 
+// GetModelConfigJson resolves a model config (or the default one of modelType) together with its provider code and secrets
+func (m *Manager) GetModelConfigJson(id string, modelType string) (*types.ModelConfigJson, error) {
+	modelConfig, err := m.GetModelConfigByIDOrDefault(id, modelType)
+	if err != nil {
+		return nil, err
+	}
+
+	if modelConfig.ProviderID == "" {
+		return nil, fmt.Errorf("model %s provider_id is empty, config_json may have unexpected value", modelConfig.ModelName)
+	}
+
+	providerCode, err := m.GetProviderCodeByID(modelConfig.ProviderID)
+	if err != nil {
+		return nil, fmt.Errorf("model provider %s not found: %w", modelConfig.ProviderID, err)
+	}
+
+	modelConfigJson := modelConfig.ToModelConfigJson(providerCode)
+	if err := m.ResolveSecretReference(modelConfigJson); err != nil {
+		return nil, fmt.Errorf("failed to resolve secrets of model %s: %w", modelConfig.ModelName, err)
+	}
+
+	return modelConfigJson, nil
+}
+
 func (m *Manager) GetDefaultModelConfig(modelType string) (*types.ModelConfig, error) {
 	var row types.ModelConfig
 	err := m.App.RecordQuery(ModelConfigCollectionName).
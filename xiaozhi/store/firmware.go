@@ -0,0 +1,152 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/phamviet/xiaozhi-hub/internal/firmware"
+	"github.com/phamviet/xiaozhi-hub/xiaozhi/types"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+)
+
+const (
+	FirmwareCollectionName      = "ai_firmware"
+	RolloutCollectionName       = "ai_firmware_rollout"
+	RolloutDeviceCollectionName = "ai_firmware_rollout_device"
+)
+
+// ResolveFirmware returns the build to offer to the device and the rollout it goes through, nil when up to date.
+// A pinned device is only offered its pinned build, the others only when auto_update is on.
+func (m *Manager) ResolveFirmware(device *types.Device, board, current string) (*core.Record, string, error) {
+	record, err := m.App.FindRecordById(DeviceCollectionName, device.Id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if pinned := record.GetString("pinned_firmware"); pinned != "" {
+		build, err := m.App.FindRecordById(FirmwareCollectionName, pinned)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to load pinned firmware: %w", err)
+		}
+		if !build.GetBool("enabled") || build.GetString("board") != board || firmware.Compare(build.GetString("version"), current) == 0 {
+			return nil, "", nil
+		}
+
+		return build, "", nil
+	}
+
+	if !device.AutoUpdate {
+		return nil, "", nil
+	}
+
+	records, err := m.App.FindRecordsByFilter(FirmwareCollectionName, "board = {:board} && enabled = true", "", 0, 0,
+		dbx.Params{"board": board})
+	if err != nil {
+		return nil, "", err
+	}
+
+	builds := make([]firmware.Build, len(records))
+	for i, record := range records {
+		builds[i] = firmware.Build{ID: record.Id, Board: record.GetString("board"), Version: record.GetString("version")}
+	}
+
+	rollouts, err := m.boardRollouts(board)
+	if err != nil {
+		return nil, "", err
+	}
+
+	target := firmware.Device{ID: device.Id, Tags: jsonStrings(record, "tags"), Failed: map[string]bool{}}
+	failed, err := m.App.FindRecordsByFilter(RolloutDeviceCollectionName, "device = {:device} && status = {:status}", "", 0, 0,
+		dbx.Params{"device": device.Id, "status": firmware.DeviceFailed})
+	if err != nil {
+		return nil, "", err
+	}
+	for _, track := range failed {
+		target.Failed[track.GetString("rollout")] = true
+	}
+
+	offer, ok := firmware.Pick(builds, rollouts, target, board, current)
+	if !ok {
+		return nil, "", nil
+	}
+
+	for _, record := range records {
+		if record.Id == offer.Build.ID {
+			return record, offer.RolloutID, nil
+		}
+	}
+
+	return nil, "", nil
+}
+
+func (m *Manager) boardRollouts(board string) ([]firmware.Rollout, error) {
+	records, err := m.App.FindRecordsByFilter(RolloutCollectionName, "firmware.board = {:board}", "", 0, 0, dbx.Params{"board": board})
+	if err != nil {
+		return nil, err
+	}
+
+	rollouts := make([]firmware.Rollout, len(records))
+	for i, record := range records {
+		rollouts[i] = firmware.Rollout{
+			ID:      record.Id,
+			BuildID: record.GetString("firmware"),
+			Status:  record.GetString("status"),
+			Percent: record.GetInt("percent"),
+			Tags:    jsonStrings(record, "tags"),
+		}
+	}
+
+	return rollouts, nil
+}
+
+// jsonStrings reads a json array of strings, anything else counts as empty
+func jsonStrings(record *core.Record, field string) []string {
+	var values []string
+	if err := json.Unmarshal([]byte(record.GetString(field)), &values); err != nil {
+		return nil
+	}
+
+	return values
+}
+
+// UpdateDeviceFirmware records the version a device reports on OTA check
+func (m *Manager) UpdateDeviceFirmware(deviceID, version string) error {
+	record, err := m.App.FindRecordById(DeviceCollectionName, deviceID)
+	if err != nil {
+		return err
+	}
+
+	if record.GetString("firmware_version") == version {
+		return nil
+	}
+
+	record.Set("firmware_version", version)
+
+	return m.App.Save(record)
+}
+
+// HashFirmwareUpload sets sha256 and size from a newly uploaded firmware file
+func HashFirmwareUpload(record *core.Record) error {
+	for _, file := range record.GetUnsavedFiles("file") {
+		r, err := file.Reader.Open()
+		if err != nil {
+			return err
+		}
+
+		hash := sha256.New()
+		size, err := io.Copy(hash, r)
+		_ = r.Close()
+		if err != nil {
+			return fmt.Errorf("failed to hash firmware: %w", err)
+		}
+
+		record.Set("sha256", hex.EncodeToString(hash.Sum(nil)))
+		record.Set("size", size)
+	}
+
+	return nil
+}
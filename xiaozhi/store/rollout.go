@@ -0,0 +1,199 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/phamviet/xiaozhi-hub/internal/firmware"
+	"github.com/pocketbase/dbx"
+	"github.com/pocketbase/pocketbase/core"
+	pbtypes "github.com/pocketbase/pocketbase/tools/types"
+)
+
+// DefaultCheckInTimeout is used when a rollout has no check_in_timeout, a device reboots into the new build within minutes
+const DefaultCheckInTimeout = 30 * time.Minute
+
+// RecordOffer starts tracking a device the rollout build was offered to
+func (m *Manager) RecordOffer(rolloutID, deviceID, current string) error {
+	_, err := m.findTrack("rollout = {:rollout} && device = {:device}", dbx.Params{"rollout": rolloutID, "device": deviceID})
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	collection, err := m.App.FindCollectionByNameOrId(RolloutDeviceCollectionName)
+	if err != nil {
+		return err
+	}
+
+	track := core.NewRecord(collection)
+	track.Set("rollout", rolloutID)
+	track.Set("device", deviceID)
+	track.Set("status", firmware.DeviceOffered)
+	track.Set("from_version", current)
+	track.Set("offered", pbtypes.NowDateTime())
+
+	return m.App.Save(track)
+}
+
+// RecordDownload marks the device as taking the update, from now on it has to check in with the new version
+func (m *Manager) RecordDownload(buildID, deviceID string) error {
+	track, err := m.findTrack("rollout.firmware = {:build} && device = {:device} && (status = {:offered} || status = {:downloaded})",
+		dbx.Params{"build": buildID, "device": deviceID, "offered": firmware.DeviceOffered, "downloaded": firmware.DeviceDownloaded})
+	if errors.Is(err, sql.ErrNoRows) {
+		// released to every device or pinned, nothing to track
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	track.Set("status", firmware.DeviceDownloaded)
+	track.Set("downloaded", pbtypes.NowDateTime())
+
+	return m.App.Save(track)
+}
+
+// EvaluateRollouts judges the devices of running rollouts from their OTA checks, refreshes the
+// counters and halts active rollouts with more failed devices than they tolerate
+func (m *Manager) EvaluateRollouts(now time.Time) error {
+	rollouts, err := m.App.FindRecordsByFilter(RolloutCollectionName, "status = {:active} || status = {:paused}", "", 0, 0,
+		dbx.Params{"active": firmware.RolloutActive, "paused": firmware.RolloutPaused})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, rollout := range rollouts {
+		if err := m.evaluateRollout(rollout, now); err != nil {
+			errs = append(errs, fmt.Errorf("rollout %s: %w", rollout.Id, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m *Manager) evaluateRollout(rollout *core.Record, now time.Time) error {
+	build, err := m.App.FindRecordById(FirmwareCollectionName, rollout.GetString("firmware"))
+	if err != nil {
+		return err
+	}
+
+	timeout := time.Duration(rollout.GetInt("check_in_timeout")) * time.Minute
+	if timeout == 0 {
+		timeout = DefaultCheckInTimeout
+	}
+
+	tracks, err := m.App.FindRecordsByFilter(RolloutDeviceCollectionName, "rollout = {:rollout}", "", 0, 0, dbx.Params{"rollout": rollout.Id})
+	if err != nil {
+		return err
+	}
+
+	var offered, downloaded, updated, failed int
+	lastError := ""
+	for _, track := range tracks {
+		if err := m.judgeTrack(track, build.GetString("version"), now, timeout); err != nil {
+			m.App.Logger().Warn("Failed to judge rollout device", "error", err, "rollout", rollout.Id, "device", track.GetString("device"))
+		}
+
+		offered++
+		if !track.GetDateTime("downloaded").IsZero() {
+			downloaded++
+		}
+		switch track.GetString("status") {
+		case firmware.DeviceUpdated:
+			updated++
+		case firmware.DeviceFailed:
+			failed++
+			lastError = track.GetString("error")
+		}
+	}
+
+	rollout.Set("offered", offered)
+	rollout.Set("downloaded", downloaded)
+	rollout.Set("updated", updated)
+	rollout.Set("failed", failed)
+
+	if rollout.GetString("status") == firmware.RolloutActive && failed > rollout.GetInt("max_failures") {
+		rollout.Set("status", firmware.RolloutHalted)
+		rollout.Set("halted", now)
+		rollout.Set("halt_reason", truncate(fmt.Sprintf("%d of %d devices failed, last: %s", failed, downloaded, lastError), 512))
+		m.App.Logger().Warn("Firmware rollout halted", "rollout", rollout.Id, "version", build.GetString("version"), "failed", failed)
+	}
+
+	return m.App.Save(rollout)
+}
+
+// judgeTrack moves a device that has not settled yet from what it reported on its OTA checks
+func (m *Manager) judgeTrack(track *core.Record, target string, now time.Time, timeout time.Duration) error {
+	status := track.GetString("status")
+	if status != firmware.DeviceOffered && status != firmware.DeviceDownloaded {
+		return nil
+	}
+
+	device, err := m.App.FindRecordById(DeviceCollectionName, track.GetString("device"))
+	if err != nil {
+		return err
+	}
+
+	// after a download the first check decides, an offered device may report the new version any time later
+	since, sort := track.GetDateTime("offered").Time(), "-created"
+	if status == firmware.DeviceDownloaded {
+		since, sort = track.GetDateTime("downloaded").Time(), "created"
+	}
+
+	reported, err := m.reportedVersion(device.GetString("mac_address"), since, sort)
+	if err != nil {
+		return err
+	}
+
+	next, reason := firmware.Judge(status, target, reported, track.GetDateTime("downloaded").Time(), now, timeout)
+	if next == status && reported == track.GetString("reported_version") {
+		return nil
+	}
+
+	track.Set("status", next)
+	track.Set("checked", now)
+	if reported != "" {
+		track.Set("reported_version", reported)
+	}
+	if reason != "" {
+		track.Set("error", truncate(reason, 512))
+	}
+
+	return m.App.Save(track)
+}
+
+// reportedVersion reads application.version from the ota_requests of a device made after since, empty when there are none
+func (m *Manager) reportedVersion(macAddress string, since time.Time, sort string) (string, error) {
+	records, err := m.App.FindRecordsByFilter(OTARequestsCollectionName, "mac_address = {:mac} && created > {:since}", sort, 1, 0,
+		dbx.Params{"mac": macAddress, "since": since.UTC().Format(pbtypes.DefaultDateLayout)})
+	if err != nil || len(records) == 0 {
+		return "", err
+	}
+
+	var body struct {
+		Application struct {
+			Version string `json:"version"`
+		} `json:"application"`
+	}
+	if err := records[0].UnmarshalJSONField("body_json", &body); err != nil {
+		return "", fmt.Errorf("invalid ota request body: %w", err)
+	}
+
+	return body.Application.Version, nil
+}
+
+func (m *Manager) findTrack(filter string, params dbx.Params) (*core.Record, error) {
+	return m.App.FindFirstRecordByFilter(RolloutDeviceCollectionName, filter, params)
+}
+
+// truncate cuts s to n runes, the text field limits count runes
+func truncate(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+
+	return s
+}
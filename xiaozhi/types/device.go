@@ -21,4 +21,5 @@ type Device struct {
 	Challenge     string         `db:"challenge" json:"challenge"`
 	HmacKey       string         `db:"hmac_key" json:"hmacKey"`
 	LastConnected types.DateTime `db:"last_connected" json:"lastConnected"`
+	AutoUpdate    bool           `db:"auto_update" json:"autoUpdate"`
 }